@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"go-wiki/web"
+)
+
+// wiki [serve] [flags]        run the wiki server
+// wiki useradd [flags] NAME   create or update an account
+// wiki export [flags] DIR     write the wiki to DIR as a static site
+// wiki backup [flags] FILE    archive every page, revision and attachment
+// wiki restore [flags] FILE   restore an archive made by backup
+func main() {
+	args := os.Args[1:]
+	cmd := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+
+	var err error
+	switch cmd {
+	case "serve":
+		err = serve(args)
+	case "useradd":
+		err = useradd(args)
+	case "export":
+		err = export(args)
+	case "backup":
+		err = backup(args)
+	case "restore":
+		err = restore(args)
+	default:
+		err = fmt.Errorf("unknown command %q", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func serve(args []string) error {
+	var cfg web.Config
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	fs.StringVar(&cfg.Addr, "addr", ":8080", "listen address")
+	fs.StringVar(&cfg.DataDir, "data", ".", "directory holding the pages")
+	fs.StringVar(&cfg.GitDir, "git", "", "git repository to keep the pages in as commits instead of -data")
+	fs.StringVar(&cfg.TemplateDir, "templates", "", "directory of *.html files overriding the built-in templates")
+	fs.StringVar(&cfg.AuthFile, "auth", "", "JSON file of user accounts and access rules; enables login")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", 0, "maximum duration for reading a request (default 10s)")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", 0, "maximum duration for writing a response (default 30s)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", 0, "how long to wait for in-flight requests on shutdown (default 15s)")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", "", "TLS key file")
+	fs.Int64Var(&cfg.MaxAttachmentSize, "max-attachment-size", 0, "largest file that can be attached to a page in bytes (default 10 MiB)")
+	fs.IntVar(&cfg.TOCMinHeadings, "toc-min-headings", 0, "headings a page needs for a table of contents, -1 for none (default 4)")
+	fs.Parse(args)
+
+	s, err := web.NewServer(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("serving wiki from %s on %s", pagesDir(cfg), cfg.Addr)
+	return s.Run(ctx)
+}
+
+// pagesDir is where the wiki keeps its pages
+func pagesDir(cfg web.Config) string {
+	if cfg.GitDir != "" {
+		return cfg.GitDir
+	}
+	return cfg.DataDir
+}
+
+// export writes the pages anonymous visitors may read, so a snapshot never leaks restricted pages
+func export(args []string) error {
+	var cfg web.Config
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	fs.StringVar(&cfg.DataDir, "data", ".", "directory holding the pages")
+	fs.StringVar(&cfg.GitDir, "git", "", "git repository to keep the pages in as commits instead of -data")
+	fs.StringVar(&cfg.TemplateDir, "templates", "", "directory of *.html files overriding the built-in templates")
+	fs.StringVar(&cfg.AuthFile, "auth", "", "JSON file of user accounts and access rules; pages anonymous visitors cannot read are left out")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: wiki export [-data DIR | -git DIR] [-templates DIR] [-auth FILE] DIR")
+	}
+
+	s, err := web.NewServer(cfg)
+	if err != nil {
+		return err
+	}
+	if err := s.Wiki.Export(fs.Arg(0)); err != nil {
+		return err
+	}
+	log.Printf("exported wiki from %s to %s", pagesDir(cfg), fs.Arg(0))
+	return nil
+}
+
+// archiveFormat picks the format of a backup from its file name unless one was given
+func archiveFormat(format, name string) string {
+	if format != "" {
+		return format
+	}
+	if strings.HasSuffix(name, ".zip") {
+		return web.Zip
+	}
+	return web.TarGz
+}
+
+func backup(args []string) error {
+	var cfg web.Config
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	fs.StringVar(&cfg.DataDir, "data", ".", "directory holding the pages")
+	fs.StringVar(&cfg.GitDir, "git", "", "git repository to keep the pages in as commits instead of -data")
+	format := fs.String("format", "", "archive format, tar.gz or zip (default from the file name)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: wiki backup [-data DIR | -git DIR] [-format FORMAT] FILE")
+	}
+
+	s, err := web.NewServer(cfg)
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if err := s.Wiki.Backup(f, archiveFormat(*format, name)); err != nil {
+		f.Close()
+		os.Remove(name)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("backed up wiki from %s to %s", pagesDir(cfg), name)
+	return nil
+}
+
+// restore writes to the data directory directly, so the server should not be running
+func restore(args []string) error {
+	var cfg web.Config
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.StringVar(&cfg.DataDir, "data", ".", "directory holding the pages")
+	fs.StringVar(&cfg.GitDir, "git", "", "git repository to keep the pages in as commits instead of -data")
+	format := fs.String("format", "", "archive format, tar.gz or zip (default from the file name)")
+	policyName := fs.String("policy", "skip", "what to do with pages that already exist: skip, overwrite or merge")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: wiki restore [-data DIR | -git DIR] [-format FORMAT] [-policy POLICY] FILE")
+	}
+
+	var policy web.ConflictPolicy
+	if err := policy.UnmarshalText([]byte(*policyName)); err != nil {
+		return err
+	}
+	s, err := web.NewServer(cfg)
+	if err != nil {
+		return err
+	}
+	name := fs.Arg(0)
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	report, err := s.Wiki.Restore(f, archiveFormat(*format, name), policy)
+	if report != nil {
+		log.Printf("restored %d new pages, overwrote %d, merged %d, skipped %d and wrote %d attachments",
+			len(report.Created), len(report.Overwritten), len(report.Merged), len(report.Skipped), report.Files)
+	}
+	return err
+}
+
+// useradd reads the password from $WIKI_PASSWORD or the first line of stdin
+func useradd(args []string) error {
+	fs := flag.NewFlagSet("useradd", flag.ExitOnError)
+	authFile := fs.String("auth", "users.json", "JSON file of user accounts and access rules")
+	roleName := fs.String("role", "edit", "role of the user: read, edit or admin")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: wiki useradd [-auth FILE] [-role ROLE] NAME")
+	}
+
+	var role web.Role
+	if err := role.UnmarshalText([]byte(*roleName)); err != nil {
+		return err
+	}
+	password := os.Getenv("WIKI_PASSWORD")
+	if password == "" {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("error reading password: %v", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	auth, err := web.LoadAuth(*authFile)
+	if err != nil {
+		return err
+	}
+	return auth.SetUser(fs.Arg(0), password, role)
+}
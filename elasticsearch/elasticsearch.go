@@ -24,7 +24,12 @@ package elastic
 import (
 	"fmt"
 	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"unicode"
 )
 
 // Core types =================================
@@ -36,9 +41,10 @@ type Document struct {
 
 // In Kafka, this would be a partition
 type Shard struct {
-	ID       int
-	Data     map[string]Document // Storage
-	Inverted map[string][]string // Index: term -> docIDs
+	ID          int
+	Data        map[string]Document       // Storage
+	Inverted    map[string][]string       // Index: term -> docIDs
+	Frequencies map[string]map[string]int // Relevance: docID -> term -> occurrences
 	sync.RWMutex
 }
 
@@ -51,11 +57,20 @@ type Index struct {
 // Cluster simulation =========================
 var (
 	indices    = make(map[string]*Index)
+	indicesMu  sync.RWMutex
 	shardCount = 3
 )
 
 // NewIndex creates an index with shards
 func NewIndex(name string) *Index {
+	idx := newIndex(name)
+	indicesMu.Lock()
+	defer indicesMu.Unlock()
+	indices[name] = idx
+	return idx
+}
+
+func newIndex(name string) *Index {
 	idx := &Index{
 		Name:   name,
 		Shards: make([]*Shard, shardCount),
@@ -63,15 +78,29 @@ func NewIndex(name string) *Index {
 
 	for i := range shardCount {
 		idx.Shards[i] = &Shard{
-			ID:       i,
-			Data:     make(map[string]Document),
-			Inverted: make(map[string][]string),
+			ID:          i,
+			Data:        make(map[string]Document),
+			Inverted:    make(map[string][]string),
+			Frequencies: make(map[string]map[string]int),
 		}
 	}
-	indices[name] = idx
 	return idx
 }
 
+// DeleteIndex drops an index and all of its documents
+func DeleteIndex(name string) {
+	indicesMu.Lock()
+	defer indicesMu.Unlock()
+	delete(indices, name)
+}
+
+func getIndex(name string) (*Index, bool) {
+	indicesMu.RLock()
+	defer indicesMu.RUnlock()
+	idx, exists := indices[name]
+	return idx, exists
+}
+
 // Hash routing (like our Kafka implementation) ========
 func getShard(id string) int {
 	h := fnv.New32a()
@@ -80,31 +109,76 @@ func getShard(id string) int {
 }
 
 // CRUD Operations ===========================
+// IndexDocument stores doc, replacing any previous version with the same ID.
+// Every field is indexed as an exact "field:value" term, and string fields are also
+// tokenized into "field:token" terms for full-text search.
 func IndexDocument(doc Document) error {
+	indicesMu.Lock()
 	idx, exists := indices[doc.Index]
 	if !exists {
-		idx = NewIndex(doc.Index)
+		idx = newIndex(doc.Index)
+		indices[doc.Index] = idx
 	}
+	indicesMu.Unlock()
 
 	shard := idx.Shards[getShard(doc.ID)]
 
 	shard.Lock()
 	defer shard.Unlock()
 
+	// Re-indexing must not leave postings of the old version behind
+	shard.remove(doc.ID)
+
 	// Store document
 	shard.Data[doc.ID] = doc
 
 	// Update inverted index
+	freq := make(map[string]int)
 	for field, value := range doc.Body {
-		term := fmt.Sprintf("%s:%v", field, value)
+		freq[fmt.Sprintf("%s:%v", field, value)]++
+		if s, ok := value.(string); ok {
+			for _, token := range Tokenize(s) {
+				freq[field+":"+token]++
+			}
+		}
+	}
+	for term := range freq {
 		shard.Inverted[term] = append(shard.Inverted[term], doc.ID)
 	}
+	shard.Frequencies[doc.ID] = freq
 
 	return nil
 }
 
+// DeleteDocument removes a document from an index; deleting a missing document is not an error
+func DeleteDocument(index, id string) error {
+	idx, exists := getIndex(index)
+	if !exists {
+		return fmt.Errorf("index not found")
+	}
+	shard := idx.Shards[getShard(id)]
+	shard.Lock()
+	defer shard.Unlock()
+	shard.remove(id)
+	return nil
+}
+
+// remove drops a document and its postings; the caller must hold the shard lock
+func (s *Shard) remove(id string) {
+	for term := range s.Frequencies[id] {
+		ids := slices.DeleteFunc(s.Inverted[term], func(d string) bool { return d == id })
+		if len(ids) == 0 {
+			delete(s.Inverted, term)
+		} else {
+			s.Inverted[term] = ids
+		}
+	}
+	delete(s.Frequencies, id)
+	delete(s.Data, id)
+}
+
 func Search(index, query string) ([]Document, error) {
-	idx, exists := indices[index]
+	idx, exists := getIndex(index)
 	if !exists {
 		return nil, fmt.Errorf("index not found")
 	}
@@ -126,7 +200,92 @@ func Search(index, query string) ([]Document, error) {
 	return results, nil
 }
 
+// Hit is a full-text search result with its relevance score
+type Hit struct {
+	Document
+	Score float64
+}
+
+// SearchText runs a full-text query against the given fields of an index.
+// Every query token must appear in at least one of the fields. Hits are ranked
+// by TF-IDF: tokens that are frequent in a document but rare in the index score highest.
+func SearchText(index, query string, fields ...string) ([]Hit, error) {
+	idx, exists := getIndex(index)
+	if !exists {
+		return nil, fmt.Errorf("index not found")
+	}
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	// Like ES, query each shard (scatter) and merge the results (gather)
+	total := 0
+	df := make(map[string]int) // token -> number of documents containing it
+	matches := make(map[string]map[string]int)
+	docs := make(map[string]Document)
+	for _, shard := range idx.Shards {
+		shard.RLock()
+		total += len(shard.Data)
+		var candidates map[string]bool
+		for _, token := range tokens {
+			found := make(map[string]bool)
+			for _, field := range fields {
+				for _, id := range shard.Inverted[field+":"+token] {
+					found[id] = true
+				}
+			}
+			df[token] += len(found)
+			if candidates == nil {
+				candidates = found
+				continue
+			}
+			for id := range candidates {
+				if !found[id] {
+					delete(candidates, id)
+				}
+			}
+		}
+		for id := range candidates {
+			counts := make(map[string]int)
+			for _, token := range tokens {
+				for _, field := range fields {
+					counts[token] += shard.Frequencies[id][field+":"+token]
+				}
+			}
+			matches[id] = counts
+			docs[id] = shard.Data[id]
+		}
+		shard.RUnlock()
+	}
+
+	hits := make([]Hit, 0, len(matches))
+	for id, counts := range matches {
+		score := 0.0
+		for token, tf := range counts {
+			idf := math.Log(1 + float64(total)/float64(df[token]))
+			score += (1 + math.Log(float64(tf))) * idf
+		}
+		hits = append(hits, Hit{Document: docs[id], Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits, nil
+}
+
 // Helper functions ==========================
+
+// Tokenize splits text into lowercase words, the unit of full-text matching
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
 func parseQuery(q string) string {
 	// Simplified - real ES would parse properly
 	return q
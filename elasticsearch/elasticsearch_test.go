@@ -1 +1,56 @@
 package elastic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "world", "2026", "café"}, Tokenize("Hello, world! 2026 -- Café"))
+}
+
+func TestSearchExactTerm(t *testing.T) {
+	defer DeleteIndex("books")
+	assert.NoError(t, IndexDocument(Document{ID: "1", Index: "books", Body: map[string]any{"author": "Tolkien"}}))
+
+	docs, err := Search("books", "author:Tolkien")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(docs))
+
+	_, err = Search("missing", "author:Tolkien")
+	assert.Error(t, err)
+}
+
+func TestSearchTextRanking(t *testing.T) {
+	defer DeleteIndex("pages")
+	IndexDocument(Document{ID: "a", Index: "pages", Body: map[string]any{"body": "go go go concurrency"}})
+	IndexDocument(Document{ID: "b", Index: "pages", Body: map[string]any{"body": "go channels"}})
+	IndexDocument(Document{ID: "c", Index: "pages", Body: map[string]any{"body": "rust"}})
+
+	hits, err := SearchText("pages", "Go", "body")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(hits))
+	assert.Equal(t, "a", hits[0].ID)
+	assert.Greater(t, hits[0].Score, hits[1].Score)
+
+	// All tokens must match
+	hits, _ = SearchText("pages", "go channels", "body")
+	assert.Equal(t, 1, len(hits))
+	assert.Equal(t, "b", hits[0].ID)
+}
+
+func TestReindexAndDelete(t *testing.T) {
+	defer DeleteIndex("pages")
+	IndexDocument(Document{ID: "a", Index: "pages", Body: map[string]any{"body": "old words"}})
+	IndexDocument(Document{ID: "a", Index: "pages", Body: map[string]any{"body": "new words"}})
+
+	hits, _ := SearchText("pages", "old", "body")
+	assert.Empty(t, hits)
+	hits, _ = SearchText("pages", "words", "body")
+	assert.Equal(t, 1, len(hits))
+
+	assert.NoError(t, DeleteDocument("pages", "a"))
+	hits, _ = SearchText("pages", "words", "body")
+	assert.Empty(t, hits)
+}
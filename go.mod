@@ -5,6 +5,7 @@ go 1.24.1
 require (
 	github.com/elastic/go-elasticsearch/v9 v9.0.0-20250415132954-a378beaf6bb8
 	github.com/stretchr/testify v1.10.0
+	github.com/yuin/goldmark v1.8.6
 )
 
 require (
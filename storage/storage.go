@@ -17,12 +17,18 @@ type Storage[T any] interface {
 	Put(key string, value T)
 	Get(key string) (T, bool)
 	Delete(key string) bool
+	Keys() []string
 }
 
 type MemoryStorage[T any] struct {
 	cache map[string]T
 }
 
+// NewMemory returns an empty MemoryStorage
+func NewMemory[T any]() *MemoryStorage[T] {
+	return &MemoryStorage[T]{cache: make(map[string]T)}
+}
+
 func (m *MemoryStorage[T]) Put(key string, value T) {
 	m.cache[key] = value
 }
@@ -40,6 +46,14 @@ func (m *MemoryStorage[T]) Delete(key string) bool {
 	return false
 }
 
+func (m *MemoryStorage[T]) Keys() []string {
+	keys := make([]string, 0, len(m.cache))
+	for k := range m.cache {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
 type LoggingStorage[T any] struct {
 	Storage[T]
 }
@@ -24,6 +24,20 @@ func TestStorage(t *testing.T) {
 	}
 }
 
+func TestKeys(t *testing.T) {
+	ms := NewMemory[int]()
+	if len(ms.Keys()) != 0 {
+		t.Errorf("new storage should be empty")
+	}
+	ms.Put("a", 1)
+	ms.Put("b", 2)
+	ms.Delete("a")
+	keys := ms.Keys()
+	if len(keys) != 1 || keys[0] != "b" {
+		t.Errorf("expected keys [b], got %v", keys)
+	}
+}
+
 /*
 FailNow is okay for unresolvable errors, but in most cases you want the test to continue and show all failures.
 */
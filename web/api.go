@@ -0,0 +1,218 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"slices"
+)
+
+// apiPageJSON is the JSON representation of a page in the /api/v1 API
+type apiPageJSON struct {
+	Title      string   `json:"title"`
+	Body       string   `json:"body,omitempty"`
+	Revision   int      `json:"revision"`
+	Categories []string `json:"categories,omitempty"`
+}
+
+// apiEdit is the request body for creating or updating a page
+type apiEdit struct {
+	Title   string  `json:"title"`
+	Body    *string `json:"body"`
+	Summary string  `json:"summary"`
+	Author  string  `json:"author"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, apiError{Error: msg})
+}
+
+// decodeEdit reads an edit from the request body, replying 415 unless it is declared as JSON,
+// 400 for malformed JSON and 422 for JSON that is well-formed but missing the page body
+func decodeEdit(w http.ResponseWriter, r *http.Request) (*apiEdit, bool) {
+	if !isJSON(r) {
+		writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+		return nil, false
+	}
+	var edit apiEdit
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&edit); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid JSON: "+err.Error())
+		return nil, false
+	}
+	if edit.Body == nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, "body is required")
+		return nil, false
+	}
+	if edit.Author == "" {
+		edit.Author = author(r)
+	}
+	return &edit, true
+}
+
+func toJSON(p *Page) apiPageJSON {
+	return apiPageJSON{Title: p.Title, Body: string(p.Body), Revision: p.Revision, Categories: pageCategories(p.Body)}
+}
+
+// apiPage validates the {title} path segment before calling fn
+func (wk *Wiki) apiPage(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		title, ok := normalizeTitle(r.PathValue("title"))
+		if !ok {
+			writeJSONError(w, http.StatusNotFound, "page not found")
+			return
+		}
+		need := editAccess
+		if r.Method == http.MethodGet {
+			need = readAccess
+		}
+		if !wk.allowed(r, title, need) {
+			apiDeny(w, r)
+			return
+		}
+		fn(w, r, title)
+	}
+}
+
+// apiListPages returns every page title and current revision, without bodies
+func (wk *Wiki) apiListPages(w http.ResponseWriter, r *http.Request) {
+	titles, err := wk.store.Titles()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	titles = wk.readable(r, titles)
+	slices.Sort(titles)
+	pages := make([]apiPageJSON, 0, len(titles))
+	for _, title := range titles {
+		if p, err := wk.loadPage(title); err == nil {
+			pages = append(pages, apiPageJSON{Title: p.Title, Revision: p.Revision})
+		}
+	}
+	writeJSON(w, http.StatusOK, pages)
+}
+
+func (wk *Wiki) apiGetPage(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := wk.loadPage(title)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.Header().Set("ETag", etag(p.Revision))
+	writeJSON(w, http.StatusOK, toJSON(p))
+}
+
+// apiCreatePage creates a new page, refusing with 409 if the title is taken
+func (wk *Wiki) apiCreatePage(w http.ResponseWriter, r *http.Request) {
+	edit, ok := decodeEdit(w, r)
+	if !ok {
+		return
+	}
+	title, ok := normalizeTitle(edit.Title)
+	if !ok {
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid title")
+		return
+	}
+	edit.Title = title
+	if !wk.allowed(r, edit.Title, editAccess) {
+		apiDeny(w, r)
+		return
+	}
+	p := &Page{Title: edit.Title, Body: []byte(*edit.Body)}
+	// Basing the edit on revision 0 makes the existence check and the save atomic
+	err := wk.save(p, 0, edit.Author, edit.Summary)
+	if errors.Is(err, errEditConflict) {
+		writeJSONError(w, http.StatusConflict, "page already exists")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Location", "/api/v1/pages/"+slug(p.Title))
+	w.Header().Set("ETag", etag(p.Revision))
+	writeJSON(w, http.StatusCreated, toJSON(p))
+}
+
+// apiPutPage replaces the body of a page, creating it if needed.
+// An If-Match header turns it into a conditional update answered with 412 when stale.
+func (wk *Wiki) apiPutPage(w http.ResponseWriter, r *http.Request, title string) {
+	edit, ok := decodeEdit(w, r)
+	if !ok {
+		return
+	}
+	if t, _ := normalizeTitle(edit.Title); edit.Title != "" && t != title {
+		writeJSONError(w, http.StatusUnprocessableEntity, "title does not match the URL")
+		return
+	}
+	current := wk.currentRevision(title)
+	p := &Page{Title: title, Body: []byte(*edit.Body)}
+	err := wk.save(p, ifMatch(r, current), edit.Author, edit.Summary)
+	if errors.Is(err, errEditConflict) {
+		writeJSONError(w, http.StatusPreconditionFailed, "page has been modified")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	status := http.StatusOK
+	if p.Revision == 1 {
+		status = http.StatusCreated
+	}
+	w.Header().Set("ETag", etag(p.Revision))
+	writeJSON(w, status, toJSON(p))
+}
+
+func (wk *Wiki) apiDeletePage(w http.ResponseWriter, r *http.Request, title string) {
+	err := wk.delete(title, ifMatch(r, wk.currentRevision(title)))
+	if errors.Is(err, errEditConflict) {
+		writeJSONError(w, http.StatusPreconditionFailed, "page has been modified")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// currentRevision returns the latest revision of a page, or 0 if it does not exist
+func (wk *Wiki) currentRevision(title string) int {
+	p, err := wk.loadPage(title)
+	if err != nil {
+		return 0
+	}
+	return p.Revision
+}
+
+// apiDeny asks anonymous clients for credentials and forbids everyone else
+func apiDeny(w http.ResponseWriter, r *http.Request) {
+	if currentUser(r) == nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="wiki"`)
+		writeJSONError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	writeJSONError(w, http.StatusForbidden, "forbidden")
+}
+
+// writeStoreError reports a missing page as 404 and anything else as a server error
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		writeJSONError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,79 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func apiRequest(t *testing.T, h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func decodePage(t *testing.T, rec *httptest.ResponseRecorder) apiPageJSON {
+	t.Helper()
+	var p apiPageJSON
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&p))
+	return p
+}
+
+func TestAPICreateAndGet(t *testing.T) {
+	h := newTestWiki(t)
+
+	rec := apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":"Home","body":"hello","author":"bot"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/api/v1/pages/Home", rec.Header().Get("Location"))
+	assert.Equal(t, apiPageJSON{Title: "Home", Body: "hello", Revision: 1}, decodePage(t, rec))
+
+	rec = apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":"Home","body":"again"}`)
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	rec = apiRequest(t, h, http.MethodGet, "/api/v1/pages/Home", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, apiPageJSON{Title: "Home", Body: "hello", Revision: 1}, decodePage(t, rec))
+
+	revs, _ := h.store.History("Home")
+	assert.Equal(t, "bot", revs[0].Author)
+
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, h, http.MethodGet, "/api/v1/pages/Missing", "").Code)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, h, http.MethodGet, "/api/v1/pages/bad..title", "").Code)
+}
+
+func TestAPIValidation(t *testing.T) {
+	h := newTestWiki(t)
+	assert.Equal(t, http.StatusBadRequest, apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":"Home"}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":"../not valid","body":""}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiRequest(t, h, http.MethodPut, "/api/v1/pages/Home", `{"title":"Other","body":""}`).Code)
+}
+
+func TestAPIUpdateListDelete(t *testing.T) {
+	h := newTestWiki(t)
+
+	rec := apiRequest(t, h, http.MethodPut, "/api/v1/pages/Home", `{"body":"v1"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = apiRequest(t, h, http.MethodPut, "/api/v1/pages/Home", `{"body":"v2","summary":"update"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, apiPageJSON{Title: "Home", Body: "v2", Revision: 2}, decodePage(t, rec))
+	apiRequest(t, h, http.MethodPut, "/api/v1/pages/About", `{"body":"about"}`)
+
+	rec = apiRequest(t, h, http.MethodGet, "/api/v1/pages", "")
+	var pages []apiPageJSON
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&pages))
+	assert.Equal(t, []apiPageJSON{{Title: "About", Revision: 1}, {Title: "Home", Revision: 2}}, pages)
+
+	assert.Equal(t, http.StatusNoContent, apiRequest(t, h, http.MethodDelete, "/api/v1/pages/Home", "").Code)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, h, http.MethodDelete, "/api/v1/pages/Home", "").Code)
+	assert.Equal(t, http.StatusNotFound, apiRequest(t, h, http.MethodGet, "/api/v1/pages/Home", "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, apiRequest(t, h, http.MethodPatch, "/api/v1/pages/About", "").Code)
+}
@@ -0,0 +1,210 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Attachment describes a file attached to a page
+type Attachment struct {
+	Name        string    `json:"name"`
+	ContentType string    `json:"content_type"` // sniffed from the data, never taken from the client
+	Size        int64     `json:"size"`
+	Author      string    `json:"author"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+func sortAttachments(list []Attachment) {
+	slices.SortFunc(list, func(a, b Attachment) int { return strings.Compare(a.Name, b.Name) })
+}
+
+// defaultMaxAttachmentSize limits uploads unless Config.MaxAttachmentSize says otherwise
+const defaultMaxAttachmentSize = 10 << 20
+
+const maxAttachmentNameLen = 100
+
+// maxFileNameLen is the usual file system limit on one file name, which the storage key of an
+// attachment name plus its ".json" metadata suffix must stay within
+const maxFileNameLen = 255
+
+// normalizeAttachmentName reduces an uploaded file name to its base name, reporting false
+// if nothing usable is left. Names follow the rules of title segments.
+func normalizeAttachmentName(name string) (string, bool) {
+	// Some browsers send the full client path
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || strings.HasPrefix(name, ".") || len(name) > maxAttachmentNameLen || !utf8.ValidString(name) {
+		return "", false
+	}
+	// Bytes outside ASCII take three characters each in the storage key
+	if len(storageKey(name))+len(".json") > maxFileNameLen {
+		return "", false
+	}
+	for _, r := range name {
+		if !unicode.IsPrint(r) || strings.ContainsRune(titleSpecials, r) {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// fileURL is where an attachment is served; the name is the last path segment
+func fileURL(title, name string) string {
+	return "/files/" + slug(title) + "/" + url.PathEscape(name)
+}
+
+// splitFilePath splits the path after /files/ or /delete-file/ into a title and a file name
+func splitFilePath(p string) (title, name string, ok bool) {
+	i := strings.LastIndex(p, "/")
+	if i < 0 {
+		return "", "", false
+	}
+	if title, ok = normalizeTitle(p[:i]); !ok {
+		return "", "", false
+	}
+	if name, ok = normalizeAttachmentName(p[i+1:]); !ok || name != p[i+1:] {
+		return "", "", false
+	}
+	return title, name, true
+}
+
+// inlineTypes may be shown in the browser; everything else is downloaded
+var inlineTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf", "text/plain"}
+
+// imageExtensions decide whether [[File:...]] embeds an image or links to a download
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp"}
+
+func isImageName(name string) bool {
+	return slices.Contains(imageExtensions, strings.ToLower(path.Ext(name)))
+}
+
+// fileHandler serves an attachment. The stored type was sniffed at upload, browsers are told
+// not to sniff again, and anything that is not a plain image, PDF or text file is sent as a
+// download inside a sandbox so uploaded HTML or SVG can never run scripts on the wiki's origin.
+func (wk *Wiki) fileHandler(w http.ResponseWriter, r *http.Request) {
+	title, name, ok := splitFilePath(strings.TrimPrefix(r.URL.Path, "/files/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !wk.allowed(r, title, readAccess) {
+		wk.deny(w, r)
+		return
+	}
+	a, data, err := wk.store.LoadAttachment(title, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	disposition := "attachment"
+	mediaType, _, _ := mime.ParseMediaType(a.ContentType)
+	if slices.Contains(inlineTypes, mediaType) {
+		disposition = "inline"
+	}
+	h := w.Header()
+	h.Set("Content-Type", a.ContentType)
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": a.Name}))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "default-src 'none'; sandbox")
+	http.ServeContent(w, r, a.Name, a.Timestamp, bytes.NewReader(data))
+}
+
+// uploadHandler attaches the file posted in the "file" field of a multipart form, optionally
+// under the name in the "name" field. Routed through limitUpload, so the body size is limited
+// before protect parses the form.
+func (wk *Wiki) uploadHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if !wk.pageExists(title) {
+		http.Error(w, "files can only be attached to pages that exist", http.StatusNotFound)
+		return
+	}
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "no file uploaded", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	given := r.FormValue("name")
+	if given == "" {
+		given = header.Filename
+	}
+	name, ok := normalizeAttachmentName(given)
+	if !ok {
+		http.Error(w, "invalid file name", http.StatusUnprocessableEntity)
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(file, wk.maxAttachmentSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > wk.maxAttachmentSize {
+		http.Error(w, fmt.Sprintf("file is larger than %d bytes", wk.maxAttachmentSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	a := Attachment{
+		Name:        name,
+		ContentType: http.DetectContentType(data),
+		Size:        int64(len(data)),
+		Author:      author(r),
+		Timestamp:   time.Now(),
+	}
+	if err := wk.store.SaveAttachment(title, a, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/view/"+slug(title), http.StatusFound)
+}
+
+func (wk *Wiki) deleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	title, name, ok := splitFilePath(strings.TrimPrefix(r.URL.Path, "/delete-file/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !wk.allowed(r, title, editAccess) {
+		wk.deny(w, r)
+		return
+	}
+	err := wk.store.DeleteAttachment(title, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/view/"+slug(title), http.StatusFound)
+}
+
+// limitUpload turns away request bodies too large for an attachment before the form is parsed,
+// leaving some room for the other form fields
+func (wk *Wiki) limitUpload(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := wk.maxAttachmentSize + 1<<20
+		if r.ContentLength > limit {
+			http.Error(w, fmt.Sprintf("file is larger than %d bytes", wk.maxAttachmentSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		h(w, r)
+	}
+}
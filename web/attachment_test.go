@@ -0,0 +1,143 @@
+package web
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+// upload posts a file to /upload/ the way the form on the view page does
+func upload(t *testing.T, wk *Wiki, title, filename string, data []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField(csrfField, wk.csrfTokenFor(testVisitor.Value))
+	fw, err := mw.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	fw.Write(data)
+	assert.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload/"+slug(title), &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.AddCookie(testVisitor)
+	rec := httptest.NewRecorder()
+	wk.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNormalizeAttachmentName(t *testing.T) {
+	for in, want := range map[string]string{
+		"diagram.png":            "diagram.png",
+		`C:\Users\me\shot 1.png`: "shot 1.png",
+		"../../etc/passwd":       "passwd",
+		"  build   output.log ":  "build output.log",
+		"Übersicht.pdf":          "Übersicht.pdf",
+	} {
+		got, ok := normalizeAttachmentName(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, want, got)
+	}
+	for _, in := range []string{"", "dir/", ".htaccess", "a#b.png", "a%2F.png", "x\x00.png", strings.Repeat("x", maxAttachmentNameLen+1)} {
+		_, ok := normalizeAttachmentName(in)
+		assert.False(t, ok, in)
+	}
+}
+
+func TestUploadAndServeAttachment(t *testing.T) {
+	h := newTestWiki(t)
+	assert.Equal(t, http.StatusNotFound, upload(t, h, "Team/Runbook", "diagram.png", pngHeader).Code)
+	post(t, h, "/save/Team/Runbook", url.Values{"body": {"Architecture: [[File:diagram.png|the diagram]] and [[File:Other/log.txt]]"}})
+
+	rec := upload(t, h, "Team/Runbook", "diagram.png", pngHeader)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/view/Team/Runbook", rec.Header().Get("Location"))
+
+	rec = get(t, h, "/view/Team/Runbook")
+	body := rec.Body.String()
+	assert.Contains(t, body, `<img class="attachment" src="/files/Team/Runbook/diagram.png" alt="the diagram">`)
+	assert.Contains(t, body, `<a class="attachment" href="/files/Other/log.txt">log.txt</a>`)
+	assert.Contains(t, body, `<a href="/files/Team/Runbook/diagram.png">diagram.png</a>`)
+	assert.Contains(t, body, `enctype="multipart/form-data"><input type="hidden" name="csrf_token"`)
+
+	rec = get(t, h, "/files/Team/Runbook/diagram.png")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `inline; filename=diagram.png`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, pngHeader, rec.Body.Bytes())
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/files/Team/Runbook/missing.png").Code)
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/files/Team/Runbook/..%2F..%2Fetc").Code)
+}
+
+func TestAttachmentsAreServedSafely(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"x"}})
+	// The extension claims an image, the content is a script
+	upload(t, h, "Home", "evil.png", []byte("<html><script>alert(document.cookie)</script>"))
+	upload(t, h, "Home", "Überblick.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+
+	rec := get(t, h, "/files/Home/evil.png")
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=evil.png`, rec.Header().Get("Content-Disposition"))
+	assert.Contains(t, rec.Header().Get("Content-Security-Policy"), "sandbox")
+
+	rec = get(t, h, "/files/Home/%C3%9Cberblick.svg")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	// Not recognized as SVG, so browsers show the markup as text instead of running it
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), `filename*=utf-8''%C3%9Cberblick.svg`)
+}
+
+func TestUploadLimits(t *testing.T) {
+	h := newTestWiki(t)
+	h.maxAttachmentSize = 100
+	post(t, h, "/save/Home", url.Values{"body": {"x"}})
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(t, h, "Home", "big.log", bytes.Repeat([]byte("x"), 101)).Code)
+	assert.Equal(t, http.StatusFound, upload(t, h, "Home", "small.log", bytes.Repeat([]byte("x"), 100)).Code)
+	h.maxAttachmentSize = 10
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(t, h, "Home", "huge.log", bytes.Repeat([]byte("x"), 2<<20)).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, upload(t, h, "Home", ".hidden", []byte("x")).Code)
+
+	// Within maxAttachmentNameLen bytes, but too long once escaped into a file name
+	assert.Equal(t, http.StatusUnprocessableEntity, upload(t, h, "Home", strings.Repeat("図", 32)+".png", []byte("x")).Code)
+	assert.Equal(t, http.StatusFound, upload(t, h, "Home", strings.Repeat("図", 20)+".png", []byte("x")).Code)
+
+	files, _ := h.store.Attachments("Home")
+	assert.Equal(t, 2, len(files))
+}
+
+func TestDeleteAndMoveAttachments(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Old", url.Values{"body": {"[[File:a.txt]]"}})
+	upload(t, h, "Old", "a.txt", []byte("hello"))
+	upload(t, h, "Old", "b.txt", []byte("bye"))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, get(t, h, "/delete-file/Old/b.txt").Code)
+	assert.Equal(t, http.StatusFound, post(t, h, "/delete-file/Old/b.txt", nil).Code)
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/files/Old/b.txt").Code)
+
+	post(t, h, "/move/Old", url.Values{"to": {"New"}, "base": {"1"}})
+	assert.Equal(t, "hello", get(t, h, "/files/New/a.txt").Body.String())
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/files/Old/a.txt").Code)
+}
+
+func TestAttachmentsFollowPageAccess(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin := loginAs(t, wk, "admin")
+	as(t, wk, admin, http.MethodPost, "/save/Secret", url.Values{"body": {"x"}})
+	assert.NoError(t, wk.store.SaveAttachment("Secret", Attachment{Name: "keys.txt", ContentType: "text/plain"}, []byte("k")))
+
+	assert.Equal(t, http.StatusFound, get(t, wk, "/files/Secret/keys.txt").Code)
+	assert.Equal(t, http.StatusOK, as(t, wk, admin, http.MethodGet, "/files/Secret/keys.txt", nil).Code)
+	assert.Equal(t, http.StatusForbidden, upload(t, wk, "Secret", "more.txt", []byte("x")).Code)
+}
@@ -0,0 +1,629 @@
+package web
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Role is what a user may do; each role includes the ones below it
+type Role int
+
+const (
+	Anonymous Role = iota
+	Reader
+	Editor
+	Admin
+)
+
+var roleNames = []string{"anonymous", "read", "edit", "admin"}
+
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return "Role(" + strconv.Itoa(int(r)) + ")"
+	}
+	return roleNames[r]
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	i := slices.Index(roleNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown role %q", text)
+	}
+	*r = Role(i)
+	return nil
+}
+
+// User is a wiki account; the password is only kept as a salted PBKDF2 hash
+type User struct {
+	Name         string `json:"name"`
+	Role         Role   `json:"role"`
+	PasswordHash string `json:"password"`
+}
+
+// Rule sets the minimum roles for the pages whose titles match Pattern: either an exact
+// title such as "Runbook" or a prefix ending in "*" such as "Team/Infra/*" for a namespace
+type Rule struct {
+	Pattern string `json:"pattern"`
+	Read    Role   `json:"read"`
+	Edit    Role   `json:"edit"`
+}
+
+// defaultRule applies to pages no rule matches: anyone may read, editors may edit
+var defaultRule = Rule{Pattern: "*", Read: Anonymous, Edit: Editor}
+
+func (r Rule) matches(title string) bool {
+	if prefix, ok := strings.CutSuffix(r.Pattern, "*"); ok {
+		return strings.HasPrefix(title, prefix)
+	}
+	return r.Pattern == title
+}
+
+// specificity ranks rules so exact titles beat namespaces and deeper namespaces beat shallower ones
+func (r Rule) specificity() int {
+	if strings.HasSuffix(r.Pattern, "*") {
+		return len(r.Pattern)
+	}
+	return 1 << 30
+}
+
+// passwordIterations is the PBKDF2 work factor for new hashes; tests lower it
+var passwordIterations = 600_000
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+func checkPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	want, err2 := enc.DecodeString(parts[3])
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iter, len(want))
+	return err == nil && subtle.ConstantTimeCompare(got, want) == 1
+}
+
+const (
+	sessionCookie = "wiki_session"
+	sessionTTL    = 7 * 24 * time.Hour
+
+	// basicAuthTTL is how long verified Basic auth credentials are remembered, so API clients
+	// sending them with every request don't pay for a password hash each time
+	basicAuthTTL = 5 * time.Minute
+)
+
+// basicAuthChecks limits how many Basic auth passwords are hashed at once, so requests with
+// made-up credentials cannot take up every CPU
+var basicAuthChecks = make(chan struct{}, 2)
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// Auth holds the user accounts, access rules and login sessions of a wiki.
+// Accounts and rules are persisted as JSON when a path is set; sessions live in memory.
+type Auth struct {
+	mu       sync.RWMutex
+	path     string
+	users    map[string]*User
+	rules    []Rule
+	sessions map[string]session
+
+	basicKey      []byte               // keys the digests of remembered Basic auth credentials
+	basicVerified map[[32]byte]session // remembered Basic auth credentials by digest
+}
+
+// authFile is the on-disk format of an Auth
+type authFile struct {
+	Users []*User `json:"users"`
+	Rules []Rule  `json:"rules"`
+}
+
+// NewAuth returns an Auth kept in memory only
+func NewAuth() *Auth {
+	return &Auth{
+		users:         make(map[string]*User),
+		sessions:      make(map[string]session),
+		basicKey:      newSecretKey(),
+		basicVerified: make(map[[32]byte]session),
+	}
+}
+
+// LoadAuth reads accounts and rules from path, starting empty if the file does not exist yet
+func LoadAuth(path string) (*Auth, error) {
+	a := NewAuth()
+	a.path = path
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f authFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	for _, u := range f.Users {
+		a.users[u.Name] = u
+	}
+	a.rules = f.Rules
+	return a, nil
+}
+
+// persist writes accounts and rules atomically; the caller must hold the lock
+func (a *Auth) persist() error {
+	if a.path == "" {
+		return nil
+	}
+	f := authFile{Rules: a.rules}
+	for _, name := range a.userNames() {
+		f.Users = append(f.Users, a.users[name])
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := a.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.path)
+}
+
+func (a *Auth) userNames() []string {
+	names := make([]string, 0, len(a.users))
+	for name := range a.users {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// SetUser creates or updates an account; an empty password keeps the current one
+func (a *Auth) SetUser(name, password string, role Role) error {
+	if !validUserName(name) {
+		return fmt.Errorf("invalid user name %q", name)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	// Users are replaced rather than modified because requests may still hold the old value
+	u := User{Name: name}
+	if old, exists := a.users[name]; exists {
+		u = *old
+	} else if password == "" {
+		return fmt.Errorf("a password is required for new user %s", name)
+	}
+	if password != "" {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return err
+		}
+		u.PasswordHash = hash
+	}
+	u.Role = role
+	a.users[name] = &u
+	a.forgetBasic(name)
+	return a.persist()
+}
+
+// DeleteUser removes an account and ends its sessions
+func (a *Auth) DeleteUser(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, exists := a.users[name]; !exists {
+		return fmt.Errorf("user %s: %w", name, fs.ErrNotExist)
+	}
+	delete(a.users, name)
+	for token, s := range a.sessions {
+		if s.user == name {
+			delete(a.sessions, token)
+		}
+	}
+	a.forgetBasic(name)
+	return a.persist()
+}
+
+// Users lists the accounts by name
+func (a *Auth) Users() []User {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var users []User
+	for _, name := range a.userNames() {
+		users = append(users, *a.users[name])
+	}
+	return users
+}
+
+// SetRules replaces the access rules
+func (a *Auth) SetRules(rules []Rule) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = slices.Clone(rules)
+	return a.persist()
+}
+
+// Rules returns the access rules
+func (a *Auth) Rules() []Rule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return slices.Clone(a.rules)
+}
+
+func validUserName(name string) bool {
+	return name != "" && len(name) <= 64 && !strings.ContainsAny(name, " \t\r\n/:")
+}
+
+// authenticate returns the user if the password is right
+func (a *Auth) authenticate(name, password string) *User {
+	a.mu.RLock()
+	u, exists := a.users[name]
+	a.mu.RUnlock()
+	if !exists || !checkPassword(u.PasswordHash, password) {
+		return nil
+	}
+	return u
+}
+
+// login starts a session for user and returns its token
+func (a *Auth) login(user string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sessions[token] = session{user: user, expires: time.Now().Add(sessionTTL)}
+	return token, nil
+}
+
+func (a *Auth) logout(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.sessions, token)
+}
+
+// sessionUser returns the user a session token belongs to, or nil if it is unknown or expired
+func (a *Auth) sessionUser(token string) *User {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, exists := a.sessions[token]
+	if !exists {
+		return nil
+	}
+	if time.Now().After(s.expires) {
+		delete(a.sessions, token)
+		return nil
+	}
+	return a.users[s.user]
+}
+
+// basicUser returns the user for HTTP Basic auth credentials. Verified credentials are
+// remembered for basicAuthTTL; others wait their turn for a password check.
+func (a *Auth) basicUser(r *http.Request, name, password string) *User {
+	mac := hmac.New(sha256.New, a.basicKey)
+	mac.Write([]byte(name + "\x00" + password))
+	var digest [32]byte
+	mac.Sum(digest[:0])
+
+	a.mu.Lock()
+	s, exists := a.basicVerified[digest]
+	if exists && time.Now().Before(s.expires) {
+		u := a.users[s.user]
+		a.mu.Unlock()
+		return u
+	}
+	delete(a.basicVerified, digest)
+	a.mu.Unlock()
+
+	select {
+	case basicAuthChecks <- struct{}{}:
+		defer func() { <-basicAuthChecks }()
+	case <-r.Context().Done():
+		return nil
+	}
+	u := a.authenticate(name, password)
+	if u != nil {
+		a.mu.Lock()
+		// Skip it if the account changed while the password was checked
+		if a.users[name] == u {
+			a.basicVerified[digest] = session{user: name, expires: time.Now().Add(basicAuthTTL)}
+		}
+		a.mu.Unlock()
+	}
+	return u
+}
+
+// forgetBasic drops the remembered Basic auth credentials of a user; the caller must hold the lock
+func (a *Auth) forgetBasic(name string) {
+	for digest, s := range a.basicVerified {
+		if s.user == name {
+			delete(a.basicVerified, digest)
+		}
+	}
+}
+
+// userFor identifies the user making a request by session cookie or, for scripts calling the
+// API, HTTP Basic auth
+func (a *Auth) userFor(r *http.Request) *User {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if u := a.sessionUser(c.Value); u != nil {
+			return u
+		}
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/") {
+		return nil
+	}
+	if name, password, ok := r.BasicAuth(); ok {
+		return a.basicUser(r, name, password)
+	}
+	return nil
+}
+
+// rule returns the most specific rule for title
+func (a *Auth) rule(title string) Rule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	best := defaultRule
+	for _, r := range a.rules {
+		if r.matches(title) && r.specificity() >= best.specificity() {
+			best = r
+		}
+	}
+	return best
+}
+
+// access is the kind of permission a handler needs on a page
+type access int
+
+const (
+	readAccess access = iota
+	editAccess
+)
+
+// allowed reports whether user (nil for anonymous visitors) may read or edit title
+func (a *Auth) allowed(user *User, title string, need access) bool {
+	role := Anonymous
+	if user != nil {
+		role = user.Role
+	}
+	if role == Admin {
+		return true
+	}
+	rule := a.rule(title)
+	if need == editAccess {
+		return role >= max(rule.Read, rule.Edit)
+	}
+	return role >= rule.Read
+}
+
+type ctxKey int
+
+const userKey ctxKey = 0
+
+// currentUser returns the logged-in user of a request, or nil for anonymous visitors
+func currentUser(r *http.Request) *User {
+	u, _ := r.Context().Value(userKey).(*User)
+	return u
+}
+
+// identify attaches the user making the request to its context
+func (wk *Wiki) identify(r *http.Request) *http.Request {
+	if wk.auth == nil {
+		return r
+	}
+	u := wk.auth.userFor(r)
+	if u == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), userKey, u))
+}
+
+// EnableAuth turns on accounts and access control; without it the wiki is open to everyone
+func (wk *Wiki) EnableAuth(a *Auth) {
+	wk.auth = a
+}
+
+// allowed reports whether the requester may read or edit title
+func (wk *Wiki) allowed(r *http.Request, title string, need access) bool {
+	return wk.auth == nil || wk.auth.allowed(currentUser(r), title, need)
+}
+
+// isAdmin reports whether the requester may manage accounts; with auth disabled nobody can
+func (wk *Wiki) isAdmin(r *http.Request) bool {
+	u := currentUser(r)
+	return wk.auth != nil && u != nil && u.Role == Admin
+}
+
+// readable filters titles down to the pages the requester may read
+func (wk *Wiki) readable(r *http.Request, titles []string) []string {
+	return slices.DeleteFunc(slices.Clone(titles), func(t string) bool {
+		return !wk.allowed(r, t, readAccess)
+	})
+}
+
+// deny answers a request lacking permission: anonymous visitors are sent to log in
+func (wk *Wiki) deny(w http.ResponseWriter, r *http.Request) {
+	if currentUser(r) == nil && r.Method == http.MethodGet {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+		return
+	}
+	http.Error(w, "forbidden", http.StatusForbidden)
+}
+
+type loginView struct {
+	Next  string
+	Error string
+}
+
+// safeNext only allows redirects to paths on this site after logging in
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (wk *Wiki) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if wk.auth == nil {
+		http.NotFound(w, r)
+		return
+	}
+	next := safeNext(r.FormValue("next"))
+	if r.Method != http.MethodPost {
+		wk.renderTemplate(w, r, "login", &loginView{Next: next})
+		return
+	}
+	// Checked on login too, so another site cannot log visitors into an account of its choosing
+	if !wk.validCSRF(r) {
+		csrfError(w)
+		return
+	}
+	u := wk.auth.authenticate(r.FormValue("name"), r.FormValue("password"))
+	if u == nil {
+		wk.renderTemplateStatus(w, r, http.StatusUnauthorized, "login", &loginView{Next: next, Error: "Wrong user name or password."})
+		return
+	}
+	token, err := wk.auth.login(u.Name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, next, http.StatusFound)
+}
+
+func (wk *Wiki) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil && wk.auth != nil {
+		wk.auth.logout(c.Value)
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+type adminView struct {
+	Users []User
+	Roles []string
+	Rules string
+	Error string
+}
+
+// formatRules renders rules one per line as "pattern read-role edit-role" for the admin form
+func formatRules(rules []Rule) string {
+	var b strings.Builder
+	for _, r := range rules {
+		fmt.Fprintf(&b, "%s %s %s\n", r.Pattern, r.Read, r.Edit)
+	}
+	return b.String()
+}
+
+func parseRules(text string) ([]Rule, error) {
+	var rules []Rule
+	for i, line := range strings.Split(text, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("line %d: expected \"pattern read-role edit-role\"", i+1)
+		}
+		r := Rule{Pattern: fields[0]}
+		if err := r.Read.UnmarshalText([]byte(fields[1])); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		if err := r.Edit.UnmarshalText([]byte(fields[2])); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// adminHandler lets admins manage accounts and access rules
+func (wk *Wiki) adminHandler(w http.ResponseWriter, r *http.Request) {
+	if !wk.isAdmin(r) {
+		wk.deny(w, r)
+		return
+	}
+	var err error
+	if r.Method == http.MethodPost {
+		if !wk.validCSRF(r) {
+			csrfError(w)
+			return
+		}
+		switch r.FormValue("action") {
+		case "user":
+			var role Role
+			if err = role.UnmarshalText([]byte(r.FormValue("role"))); err == nil {
+				err = wk.auth.SetUser(r.FormValue("name"), r.FormValue("password"), role)
+			}
+		case "delete":
+			err = wk.auth.DeleteUser(r.FormValue("name"))
+		case "rules":
+			var rules []Rule
+			if rules, err = parseRules(r.FormValue("rules")); err == nil {
+				err = wk.auth.SetRules(rules)
+			}
+		}
+		if err == nil {
+			http.Redirect(w, r, "/admin", http.StatusFound)
+			return
+		}
+	}
+	v := &adminView{Users: wk.auth.Users(), Roles: roleNames[1:], Rules: formatRules(wk.auth.Rules())}
+	status := http.StatusOK
+	if err != nil {
+		v.Error = err.Error()
+		status = http.StatusUnprocessableEntity
+	}
+	wk.renderTemplateStatus(w, r, status, "admin", v)
+}
@@ -0,0 +1,229 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newAuthWiki returns a test wiki with accounts for every role and a protected Runbook namespace
+func newAuthWiki(t *testing.T) (*Wiki, *Auth) {
+	t.Helper()
+	passwordIterations = 1000
+	wk := newTestWiki(t)
+	a := NewAuth()
+	assert.NoError(t, a.SetUser("reader", "pw", Reader))
+	assert.NoError(t, a.SetUser("editor", "pw", Editor))
+	assert.NoError(t, a.SetUser("admin", "pw", Admin))
+	assert.NoError(t, a.SetRules([]Rule{
+		{Pattern: "Runbook*", Read: Reader, Edit: Admin},
+		{Pattern: "Secret", Read: Admin, Edit: Admin},
+	}))
+	wk.EnableAuth(a)
+	return wk, a
+}
+
+// loginAs returns the session cookie for a user
+func loginAs(t *testing.T, h *Wiki, name string) *http.Cookie {
+	t.Helper()
+	rec := post(t, h, "/login", url.Values{"name": {name}, "password": {"pw"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	cookies := rec.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	return cookies[0]
+}
+
+// as sends a request with the session cookie c, or as an anonymous visitor if c is nil
+func as(t *testing.T, h *Wiki, c *http.Cookie, method, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	if c == nil {
+		c = testVisitor
+	}
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set(csrfField, h.csrfTokenFor(c.Value))
+	req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(c)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestPasswordHash(t *testing.T) {
+	passwordIterations = 1000
+	hash, err := hashPassword("secret")
+	assert.NoError(t, err)
+	assert.NotContains(t, hash, "secret")
+	assert.True(t, checkPassword(hash, "secret"))
+	assert.False(t, checkPassword(hash, "Secret"))
+	assert.False(t, checkPassword("garbage", "secret"))
+
+	other, _ := hashPassword("secret")
+	assert.NotEqual(t, hash, other, "hashes must be salted")
+}
+
+func TestRuleSpecificity(t *testing.T) {
+	a := NewAuth()
+	a.SetRules([]Rule{
+		{Pattern: "Team/*", Read: Reader, Edit: Editor},
+		{Pattern: "Team/Infra/*", Read: Editor, Edit: Admin},
+		{Pattern: "Team/Infra/Open", Read: Anonymous, Edit: Editor},
+	})
+	assert.Equal(t, defaultRule, a.rule("Home"))
+	assert.Equal(t, Reader, a.rule("Team/Notes").Read)
+	assert.Equal(t, Editor, a.rule("Team/Infra/Runbook").Read)
+	assert.Equal(t, Anonymous, a.rule("Team/Infra/Open").Read)
+
+	editor := &User{Name: "e", Role: Editor}
+	assert.True(t, a.allowed(nil, "Home", readAccess))
+	assert.False(t, a.allowed(nil, "Home", editAccess))
+	assert.True(t, a.allowed(editor, "Home", editAccess))
+	assert.False(t, a.allowed(editor, "Team/Infra/Runbook", editAccess))
+	assert.True(t, a.allowed(&User{Role: Admin}, "Team/Infra/Runbook", editAccess))
+}
+
+func TestLogin(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+
+	rec := post(t, wk, "/login", url.Values{"name": {"editor"}, "password": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Empty(t, rec.Result().Cookies())
+
+	rec = post(t, wk, "/login", url.Values{"name": {"editor"}, "password": {"pw"}, "next": {"/edit/Home"}})
+	assert.Equal(t, "/edit/Home", rec.Header().Get("Location"))
+	c := rec.Result().Cookies()[0]
+	assert.True(t, c.HttpOnly)
+
+	// Redirects off-site are refused
+	rec = post(t, wk, "/login", url.Values{"name": {"editor"}, "password": {"pw"}, "next": {"//evil.example"}})
+	assert.Equal(t, "/", rec.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusFound, as(t, wk, c, http.MethodPost, "/logout", nil).Code)
+	assert.Equal(t, http.StatusFound, as(t, wk, c, http.MethodGet, "/edit/Home", nil).Code)
+}
+
+func TestAccessControl(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	reader, editor, admin := loginAs(t, wk, "reader"), loginAs(t, wk, "editor"), loginAs(t, wk, "admin")
+
+	// Anonymous visitors can read but are sent to log in to edit
+	rec := as(t, wk, nil, http.MethodGet, "/edit/Home", nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/login?next=%2Fedit%2FHome", rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusForbidden, as(t, wk, nil, http.MethodPost, "/save/Home", url.Values{"body": {"x"}}).Code)
+	assert.Equal(t, http.StatusForbidden, as(t, wk, reader, http.MethodPost, "/save/Home", url.Values{"body": {"x"}}).Code)
+
+	rec = as(t, wk, editor, http.MethodPost, "/save/Home", url.Values{"body": {"hello"}, "author": {"spoofed"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	revs, _ := wk.store.History("Home")
+	assert.Equal(t, "editor", revs[0].Author)
+	assert.Equal(t, http.StatusOK, as(t, wk, nil, http.MethodGet, "/view/Home", nil).Code)
+
+	// Protected runbooks
+	assert.Equal(t, http.StatusForbidden, as(t, wk, editor, http.MethodPost, "/save/RunbookDB", url.Values{"body": {"x"}}).Code)
+	assert.Equal(t, http.StatusFound, as(t, wk, admin, http.MethodPost, "/save/RunbookDB", url.Values{"body": {"steps [[Home]]"}}).Code)
+	assert.Equal(t, http.StatusOK, as(t, wk, reader, http.MethodGet, "/view/RunbookDB", nil).Code)
+	assert.Equal(t, http.StatusFound, as(t, wk, nil, http.MethodGet, "/view/RunbookDB", nil).Code)
+	assert.Equal(t, http.StatusForbidden, as(t, wk, editor, http.MethodPost, "/revert/RunbookDB/1", nil).Code)
+
+	// Pages the requester can't read are hidden from backlinks and search
+	assert.NotContains(t, as(t, wk, nil, http.MethodGet, "/backlinks/Home", nil).Body.String(), "RunbookDB")
+	assert.Contains(t, as(t, wk, reader, http.MethodGet, "/backlinks/Home", nil).Body.String(), "RunbookDB")
+	assert.NotContains(t, as(t, wk, nil, http.MethodGet, "/search?q=steps", nil).Body.String(), "RunbookDB")
+	assert.Contains(t, as(t, wk, reader, http.MethodGet, "/search?q=steps", nil).Body.String(), "RunbookDB")
+}
+
+func TestAPIAuth(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+
+	rec := apiRequest(t, wk, http.MethodPut, "/api/v1/pages/Home", `{"body":"x"}`)
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/pages/Home", strings.NewReader(`{"body":"x"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("editor", "pw")
+	rec = httptest.NewRecorder()
+	wk.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	req = httptest.NewRequest(http.MethodPut, "/api/v1/pages/Secret", strings.NewReader(`{"body":"x"}`))
+	req.SetBasicAuth("editor", "pw")
+	rec = httptest.NewRecorder()
+	wk.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Outside the API, Basic auth is not even checked
+	req = httptest.NewRequest(http.MethodGet, "/edit/Home", nil)
+	req.SetBasicAuth("editor", "pw")
+	rec = httptest.NewRecorder()
+	wk.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusFound, rec.Code, "sent to log in")
+}
+
+func TestBasicAuthIsRemembered(t *testing.T) {
+	_, a := newAuthWiki(t)
+	userFor := func(name, password string) *User {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/pages", nil)
+		req.SetBasicAuth(name, password)
+		return a.userFor(req)
+	}
+	assert.Equal(t, "editor", userFor("editor", "pw").Name)
+	assert.Equal(t, 1, len(a.basicVerified))
+	assert.Equal(t, "editor", userFor("editor", "pw").Name)
+	assert.Nil(t, userFor("editor", "wrong"))
+	assert.Equal(t, 1, len(a.basicVerified), "failures are not remembered")
+
+	// Changing the account forgets its credentials
+	assert.NoError(t, a.SetUser("editor", "new", Editor))
+	assert.Empty(t, a.basicVerified)
+	assert.Nil(t, userFor("editor", "pw"))
+	assert.Equal(t, "editor", userFor("editor", "new").Name)
+	assert.NoError(t, a.DeleteUser("editor"))
+	assert.Nil(t, userFor("editor", "new"))
+}
+
+func TestAdmin(t *testing.T) {
+	wk, a := newAuthWiki(t)
+	editor, admin := loginAs(t, wk, "editor"), loginAs(t, wk, "admin")
+
+	assert.Equal(t, http.StatusForbidden, as(t, wk, editor, http.MethodGet, "/admin", nil).Code)
+	rec := as(t, wk, admin, http.MethodGet, "/admin", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Runbook* read admin")
+
+	rec = as(t, wk, admin, http.MethodPost, "/admin", url.Values{"action": {"user"}, "name": {"carol"}, "password": {"pw"}, "role": {"read"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.NotNil(t, a.authenticate("carol", "pw"))
+
+	rec = as(t, wk, admin, http.MethodPost, "/admin", url.Values{"action": {"rules"}, "rules": {"Docs* read bogus"}})
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	rec = as(t, wk, admin, http.MethodPost, "/admin", url.Values{"action": {"rules"}, "rules": {"Docs* read edit\n"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, []Rule{{"Docs*", Reader, Editor}}, a.Rules())
+
+	// Deleting a user ends their sessions
+	assert.NoError(t, a.DeleteUser("editor"))
+	assert.Equal(t, http.StatusFound, as(t, wk, editor, http.MethodGet, "/edit/Home", nil).Code)
+}
+
+func TestAuthPersistence(t *testing.T) {
+	passwordIterations = 1000
+	path := filepath.Join(t.TempDir(), "users.json")
+	a, err := LoadAuth(path)
+	assert.NoError(t, err)
+	assert.NoError(t, a.SetUser("alice", "pw", Admin))
+	assert.NoError(t, a.SetRules([]Rule{{"Ops*", Reader, Admin}}))
+
+	b, err := LoadAuth(path)
+	assert.NoError(t, err)
+	assert.Equal(t, Admin, b.authenticate("alice", "pw").Role)
+	assert.Equal(t, a.Rules(), b.Rules())
+}
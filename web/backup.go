@@ -0,0 +1,388 @@
+package web
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Archive formats for Backup and Restore
+const (
+	TarGz = "tar.gz"
+	Zip   = "zip"
+)
+
+// backupVersion is written to every archive; Restore refuses archives from newer versions
+const backupVersion = 1
+
+// An archive holds manifest.json first, then for every page pages/<key>.json followed by its
+// attachments as files/<key>/<name key>, where keys are storage keys of the title and file name
+type backupManifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Pages   int       `json:"pages"`
+}
+
+type backupPage struct {
+	Title       string       `json:"title"`
+	Revisions   []Revision   `json:"revisions"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// archiveWriter adds files to a tar.gz or zip archive
+type archiveWriter interface {
+	add(name string, data []byte, modified time.Time) error
+	Close() error
+}
+
+type tarWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarWriter) add(name string, data []byte, modified time.Time) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modified}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := t.tw.Write(data)
+	return err
+}
+
+func (t *tarWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
+
+type zipWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipWriter) add(name string, data []byte, modified time.Time) error {
+	w, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	return z.zw.Close()
+}
+
+func newArchiveWriter(w io.Writer, format string) (archiveWriter, error) {
+	switch format {
+	case TarGz:
+		gz := gzip.NewWriter(w)
+		return &tarWriter{gz: gz, tw: tar.NewWriter(gz)}, nil
+	case Zip:
+		return &zipWriter{zw: zip.NewWriter(w)}, nil
+	}
+	return nil, fmt.Errorf("unknown archive format %q", format)
+}
+
+// readArchive calls fn with every file in the archive in order. Zip archives are read into
+// memory first because their index is at the end.
+func readArchive(r io.Reader, format string, fn func(name string, data []byte) error) error {
+	switch format {
+	case TarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		tr := tar.NewReader(gz)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				continue
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := fn(hdr.Name, data); err != nil {
+				return err
+			}
+		}
+	case Zip:
+		all, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(all), int64(len(all)))
+		if err != nil {
+			return err
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			data, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			if err := fn(f.Name, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown archive format %q", format)
+}
+
+// Backup writes every page with its full history and attachments to w as a tar.gz or zip
+// archive. Saves wait until it is done, so the archive is a consistent snapshot.
+func (wk *Wiki) Backup(w io.Writer, format string) error {
+	aw, err := newArchiveWriter(w, format)
+	if err != nil {
+		return err
+	}
+	wk.saveMu.Lock()
+	defer wk.saveMu.Unlock()
+
+	titles, err := wk.store.Titles()
+	if err != nil {
+		return err
+	}
+	slices.Sort(titles)
+	now := time.Now()
+	manifest, _ := json.MarshalIndent(backupManifest{Version: backupVersion, Created: now, Pages: len(titles)}, "", "  ")
+	if err := aw.add("manifest.json", manifest, now); err != nil {
+		return err
+	}
+	for _, title := range titles {
+		p := backupPage{Title: title}
+		if p.Revisions, err = wk.store.History(title); err != nil {
+			return err
+		}
+		if p.Attachments, err = wk.store.Attachments(title); err != nil {
+			return err
+		}
+		data, err := json.Marshal(p)
+		if err != nil {
+			return err
+		}
+		key := storageKey(title)
+		if err := aw.add("pages/"+key+".json", data, p.Revisions[len(p.Revisions)-1].Timestamp); err != nil {
+			return err
+		}
+		for _, a := range p.Attachments {
+			_, data, err := wk.store.LoadAttachment(title, a.Name)
+			if err != nil {
+				return err
+			}
+			if err := aw.add("files/"+key+"/"+storageKey(a.Name), data, a.Timestamp); err != nil {
+				return err
+			}
+		}
+	}
+	return aw.Close()
+}
+
+// ConflictPolicy decides what Restore does with a page that already exists
+type ConflictPolicy int
+
+const (
+	// Skip keeps the existing page and its attachments
+	Skip ConflictPolicy = iota
+	// Overwrite replaces the page, its history and attachments with those in the archive
+	Overwrite
+	// Merge saves the archived text as a new revision and adds attachments the page lacks
+	Merge
+)
+
+var policyNames = []string{"skip", "overwrite", "merge"}
+
+func (p ConflictPolicy) String() string {
+	if p < 0 || int(p) >= len(policyNames) {
+		return "ConflictPolicy(" + strconv.Itoa(int(p)) + ")"
+	}
+	return policyNames[p]
+}
+
+func (p *ConflictPolicy) UnmarshalText(text []byte) error {
+	i := slices.Index(policyNames, string(text))
+	if i < 0 {
+		return fmt.Errorf("unknown conflict policy %q", text)
+	}
+	*p = ConflictPolicy(i)
+	return nil
+}
+
+// RestoreReport lists what Restore did with each page in the archive
+type RestoreReport struct {
+	Created     []string
+	Overwritten []string
+	Merged      []string
+	Skipped     []string
+	Files       int // attachments written
+}
+
+// Restore reads an archive written by Backup into the wiki, resolving pages that already exist
+// with policy. Pages are restored one by one, so an invalid archive can leave some restored.
+func (wk *Wiki) Restore(r io.Reader, format string, policy ConflictPolicy) (*RestoreReport, error) {
+	wk.saveMu.Lock()
+	defer wk.saveMu.Unlock()
+
+	report := &RestoreReport{}
+	var manifest *backupManifest
+	// Attachments of the pages restored so far that are still to be written, by page key
+	pending := map[string]map[string]Attachment{}
+	err := readArchive(r, format, func(name string, data []byte) error {
+		if manifest == nil {
+			if name != "manifest.json" {
+				return fmt.Errorf("%s comes before manifest.json", name)
+			}
+			manifest = &backupManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return fmt.Errorf("invalid manifest: %v", err)
+			}
+			if manifest.Version < 1 || manifest.Version > backupVersion {
+				return fmt.Errorf("unsupported backup version %d", manifest.Version)
+			}
+			return nil
+		}
+		dir, file := path.Split(name)
+		switch dir {
+		case "pages/":
+			key, ok := strings.CutSuffix(file, ".json")
+			if !ok {
+				return fmt.Errorf("unexpected file %s", name)
+			}
+			var p backupPage
+			if err := json.Unmarshal(data, &p); err != nil {
+				return fmt.Errorf("invalid page %s: %v", name, err)
+			}
+			if storageKey(p.Title) != key {
+				return fmt.Errorf("page %s holds %q", name, p.Title)
+			}
+			files, err := wk.restorePage(&p, policy, report)
+			if err != nil {
+				return fmt.Errorf("error restoring %s: %v", p.Title, err)
+			}
+			pending[key] = files
+			return nil
+		default:
+			key, ok := strings.CutPrefix(strings.TrimSuffix(dir, "/"), "files/")
+			title, valid := titleFromKey(key)
+			if !ok || !valid {
+				return fmt.Errorf("unexpected file %s", name)
+			}
+			files, seen := pending[key]
+			if !seen {
+				return fmt.Errorf("%s comes before its page", name)
+			}
+			a, ok := files[file]
+			if !ok {
+				return nil
+			}
+			if a.Size != int64(len(data)) {
+				return fmt.Errorf("%s is %d bytes, expected %d", name, len(data), a.Size)
+			}
+			if err := wk.store.SaveAttachment(title, a, data); err != nil {
+				return err
+			}
+			delete(files, file)
+			report.Files++
+			return nil
+		}
+	})
+	if err != nil {
+		return report, err
+	}
+	if manifest == nil {
+		return report, errors.New("archive is empty")
+	}
+	return report, nil
+}
+
+// restorePage applies policy to one archived page and returns the attachments to write, by name key
+func (wk *Wiki) restorePage(p *backupPage, policy ConflictPolicy, report *RestoreReport) (map[string]Attachment, error) {
+	if title, ok := normalizeTitle(p.Title); !ok || title != p.Title {
+		return nil, errors.New("invalid title")
+	}
+	if len(p.Revisions) == 0 {
+		return nil, errors.New("no revisions")
+	}
+	for i, rev := range p.Revisions {
+		if rev.ID != i+1 {
+			return nil, fmt.Errorf("revision %d is numbered %d", i+1, rev.ID)
+		}
+	}
+	files := map[string]Attachment{}
+	for _, a := range p.Attachments {
+		if name, ok := normalizeAttachmentName(a.Name); !ok || name != a.Name {
+			return nil, fmt.Errorf("invalid attachment name %q", a.Name)
+		}
+		files[storageKey(a.Name)] = a
+	}
+
+	existing, err := wk.store.History(p.Title)
+	if err != nil {
+		return nil, err
+	}
+	latest := p.Revisions[len(p.Revisions)-1]
+	switch {
+	case len(existing) == 0:
+		report.Created = append(report.Created, p.Title)
+	case policy == Skip:
+		report.Skipped = append(report.Skipped, p.Title)
+		return nil, nil
+	case policy == Overwrite:
+		if err := wk.store.Delete(p.Title); err != nil {
+			return nil, err
+		}
+		report.Overwritten = append(report.Overwritten, p.Title)
+	case policy == Merge:
+		current := existing[len(existing)-1]
+		if !bytes.Equal(current.Body, latest.Body) {
+			page := &Page{Title: p.Title, Body: latest.Body}
+			if err := wk.saveLocked(page, anyRevision, latest.Author, fmt.Sprintf("Restored revision %d from backup", latest.ID)); err != nil {
+				return nil, err
+			}
+		}
+		have, err := wk.store.Attachments(p.Title)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range have {
+			delete(files, storageKey(a.Name))
+		}
+		report.Merged = append(report.Merged, p.Title)
+		return files, nil
+	default:
+		return nil, fmt.Errorf("unknown conflict policy %v", policy)
+	}
+
+	for _, rev := range p.Revisions {
+		if err := wk.store.Save(p.Title, rev); err != nil {
+			return nil, err
+		}
+	}
+	wk.indexLinks(p.Title, latest.Body)
+	return files, wk.indexPage(&Page{Title: p.Title, Body: latest.Body, Revision: latest.ID})
+}
@@ -0,0 +1,130 @@
+package web
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newBackupWiki(t *testing.T) *Wiki {
+	t.Helper()
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"v1"}, "author": {"alice"}})
+	post(t, h, "/save/Home", url.Values{"body": {"v2 see [[Team/Runbook]]"}, "author": {"bob"}})
+	post(t, h, "/save/Team/Runbook", url.Values{"body": {"steps"}})
+	upload(t, h, "Team/Runbook", "diagram.png", pngHeader)
+	return h
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	for _, format := range []string{TarGz, Zip} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			assert.NoError(t, newBackupWiki(t).Backup(&buf, format))
+
+			h := newTestWiki(t)
+			report, err := h.Restore(&buf, format, Skip)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"Home", "Team/Runbook"}, report.Created)
+			assert.Equal(t, 1, report.Files)
+
+			revs, _ := h.store.History("Home")
+			assert.Equal(t, 2, len(revs))
+			assert.Equal(t, "alice", revs[0].Author)
+			assert.Equal(t, "v2 see [[Team/Runbook]]", string(revs[1].Body))
+			a, data, err := h.store.LoadAttachment("Team/Runbook", "diagram.png")
+			assert.NoError(t, err)
+			assert.Equal(t, "image/png", a.ContentType)
+			assert.Equal(t, pngHeader, data)
+			assert.Equal(t, []string{"Home"}, h.linkIndex().backlinks("Team/Runbook"))
+		})
+	}
+}
+
+func TestRestoreConflictPolicies(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, newBackupWiki(t).Backup(&buf, TarGz))
+	archive := buf.Bytes()
+
+	existing := func() *Wiki {
+		h := newTestWiki(t)
+		post(t, h, "/save/Home", url.Values{"body": {"local"}, "author": {"carol"}})
+		post(t, h, "/save/Team/Runbook", url.Values{"body": {"steps"}})
+		upload(t, h, "Team/Runbook", "notes.txt", []byte("local notes"))
+		return h
+	}
+
+	h := existing()
+	report, err := h.Restore(bytes.NewReader(archive), TarGz, Skip)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home", "Team/Runbook"}, report.Skipped)
+	p, _ := h.loadPage("Home")
+	assert.Equal(t, "local", string(p.Body))
+
+	h = existing()
+	report, err = h.Restore(bytes.NewReader(archive), TarGz, Overwrite)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home", "Team/Runbook"}, report.Overwritten)
+	revs, _ := h.store.History("Home")
+	assert.Equal(t, []string{"alice", "bob"}, []string{revs[0].Author, revs[1].Author})
+	files, _ := h.store.Attachments("Team/Runbook")
+	assert.Equal(t, []string{"diagram.png"}, attachmentNames(files))
+
+	h = existing()
+	report, err = h.Restore(bytes.NewReader(archive), TarGz, Merge)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Home", "Team/Runbook"}, report.Merged)
+	revs, _ = h.store.History("Home")
+	assert.Equal(t, 2, len(revs))
+	assert.Equal(t, "v2 see [[Team/Runbook]]", string(revs[1].Body))
+	assert.Equal(t, "Restored revision 2 from backup", revs[1].Summary)
+	revs, _ = h.store.History("Team/Runbook")
+	assert.Equal(t, 1, len(revs), "identical text adds no revision")
+	files, _ = h.store.Attachments("Team/Runbook")
+	assert.Equal(t, []string{"diagram.png", "notes.txt"}, attachmentNames(files))
+}
+
+func attachmentNames(files []Attachment) []string {
+	var names []string
+	for _, a := range files {
+		names = append(names, a.Name)
+	}
+	return names
+}
+
+func TestRestoreRejectsBadArchives(t *testing.T) {
+	archive := func(files map[string]string, order ...string) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, name := range order {
+			tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))})
+			tw.Write([]byte(files[name]))
+		}
+		tw.Close()
+		gz.Close()
+		return buf.Bytes()
+	}
+	page := `{"title":"Home","revisions":[{"id":1,"body":"eA=="}]}`
+
+	for name, data := range map[string][]byte{
+		"newer version":    archive(map[string]string{"manifest.json": `{"version":99}`}, "manifest.json"),
+		"no manifest":      archive(map[string]string{"pages/Home.json": page}, "pages/Home.json"),
+		"wrong key":        archive(map[string]string{"manifest.json": `{"version":1}`, "pages/Other.json": page}, "manifest.json", "pages/Other.json"),
+		"invalid title":    archive(map[string]string{"manifest.json": `{"version":1}`, "pages/a%23b.json": `{"title":"a#b","revisions":[{"id":1}]}`}, "manifest.json", "pages/a%23b.json"),
+		"file before page": archive(map[string]string{"manifest.json": `{"version":1}`, "files/Home/x": "x"}, "manifest.json", "files/Home/x"),
+		"not an archive":   []byte("hello"),
+	} {
+		_, err := newTestWiki(t).Restore(bytes.NewReader(data), TarGz, Skip)
+		assert.Error(t, err, name)
+	}
+
+	var policy ConflictPolicy
+	assert.NoError(t, policy.UnmarshalText([]byte("merge")))
+	assert.Equal(t, Merge, policy)
+	assert.Error(t, policy.UnmarshalText([]byte("replace")))
+}
@@ -0,0 +1,154 @@
+package web
+
+import (
+	"html/template"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// frontMatterPattern matches a block of "key: value" lines between two --- lines at the very
+// start of a body, e.g.
+//
+//	---
+//	tags: [networking, dns]
+//	---
+var frontMatterPattern = regexp.MustCompile(`^---[ \t]*\r?\n((?:.*\r?\n)*?)---[ \t]*(?:\r?\n|$)`)
+
+var (
+	frontMatterField = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*):[ \t]*(.*)$`)
+	frontMatterItem  = regexp.MustCompile(`^[ \t]*-[ \t]+(.*)$`)
+)
+
+// splitFrontMatter separates front matter from the rest of a body. Only blocks made of fields,
+// list items, comments and blank lines count, so a page that merely starts with a horizontal
+// rule is left alone.
+func splitFrontMatter(body []byte) (map[string][]string, []byte) {
+	m := frontMatterPattern.FindSubmatch(body)
+	if m == nil {
+		return nil, body
+	}
+	fields := map[string][]string{}
+	key := ""
+	for _, line := range strings.Split(string(m[1]), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if f := frontMatterField.FindStringSubmatch(line); f != nil {
+			key = strings.ToLower(f[1])
+			fields[key] = append(fields[key], frontMatterValues(f[2])...)
+		} else if item := frontMatterItem.FindStringSubmatch(line); item != nil && key != "" {
+			fields[key] = append(fields[key], frontMatterValues(item[1])...)
+		} else {
+			return nil, body
+		}
+	}
+	return fields, body[len(m[0]):]
+}
+
+// frontMatterValues splits "a, b", "[a, b]" or a single value into its items
+func frontMatterValues(s string) []string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "[") && strings.HasSuffix(s, "]") {
+		s = s[1 : len(s)-1]
+	}
+	var values []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.Trim(strings.TrimSpace(v), `"'`); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// pageCategories returns the distinct categories a body puts its page in, from the tags or
+// categories fields of its front matter and from [[Category:Name]] links
+func pageCategories(body []byte) []string {
+	var categories []string
+	add := func(name string) {
+		if name, ok := normalizeTitle(name); ok && !slices.Contains(categories, name) {
+			categories = append(categories, name)
+		}
+	}
+	fields, rest := splitFrontMatter(body)
+	for _, name := range append(fields["categories"], fields["tags"]...) {
+		add(name)
+	}
+	doc := markdown.Parser().Parse(text.NewReader(rest))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if c, ok := n.(*wikiCategory); ok && entering {
+			add(c.Name)
+		}
+		return ast.WalkContinue, nil
+	})
+	return categories
+}
+
+// categoryIndex returns the graph from pages to their categories, building it on first use
+func (wk *Wiki) categoryIndex() *linkGraph {
+	wk.categoriesOnce.Do(func() {
+		wk.categories = newLinkGraph()
+		titles, _ := wk.store.Titles()
+		for _, title := range titles {
+			if p, err := wk.loadPage(title); err == nil {
+				wk.categories.update(title, pageCategories(p.Body))
+			}
+		}
+	})
+	return wk.categories
+}
+
+// categoryPage is the wiki page describing a category, shown above its members
+func categoryPage(name string) string {
+	return "Category:" + name
+}
+
+type categoryView struct {
+	Name        string // empty for the list of all categories
+	Description template.HTML
+	Pages       []string
+	Categories  []specialItem // every category with its number of pages
+}
+
+// categoryHandler serves /category/ listing every category and /category/{name} listing its pages.
+// Only pages the requester may read are listed or counted.
+func (wk *Wiki) categoryHandler(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimPrefix(r.URL.Path, "/category/")
+	index := wk.categoryIndex()
+	if raw == "" {
+		v := &categoryView{}
+		for _, name := range index.targets() {
+			if n := len(wk.readable(r, index.backlinks(name))); n > 0 {
+				v.Categories = append(v.Categories, specialItem{Title: name, Count: n})
+			}
+		}
+		wk.renderTemplate(w, r, "category", v)
+		return
+	}
+	name, ok := normalizeTitle(raw)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if raw != strings.ReplaceAll(name, " ", "_") {
+		http.Redirect(w, r, "/category/"+slug(name), http.StatusMovedPermanently)
+		return
+	}
+	v := &categoryView{Name: name, Pages: wk.readable(r, index.backlinks(name))}
+	if title := categoryPage(name); wk.allowed(r, title, readAccess) {
+		if p, err := wk.loadPage(title); err == nil {
+			html, _, err := wk.renderPage(r, title, p.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			v.Description = html
+		}
+	}
+	wk.renderTemplate(w, r, "category", v)
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	fields, rest := splitFrontMatter([]byte("---\ntitle: DNS\ntags: [networking, \"dns\"]\ncategories:\n  - Runbooks\n  - On call\n---\n# DNS\n"))
+	assert.Equal(t, map[string][]string{"title": {"DNS"}, "tags": {"networking", "dns"}, "categories": {"Runbooks", "On call"}}, fields)
+	assert.Equal(t, "# DNS\n", string(rest))
+
+	// A horizontal rule followed by text is not front matter
+	body := []byte("---\nJust some text.\n---\n")
+	fields, rest = splitFrontMatter(body)
+	assert.Nil(t, fields)
+	assert.Equal(t, body, rest)
+}
+
+func TestPageCategories(t *testing.T) {
+	body := "---\ntags: networking, Runbooks\n---\nRestart it. [[Category:Runbooks]] [[Category:On_call]]\n\n`[[Category:Code]]`"
+	assert.Equal(t, []string{"networking", "Runbooks", "On call"}, pageCategories([]byte(body)))
+	assert.Empty(t, pageCategories([]byte("[[Category]] links to a page")))
+}
+
+func TestCategoryPages(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/DNS", url.Values{"body": {"---\ntags: [Networking]\n---\nResolvers. [[Category:Runbooks]]"}})
+	post(t, h, "/save/Firewall", url.Values{"body": {"Rules. [[Category:Networking]]"}})
+	post(t, h, "/save/Category:Networking", url.Values{"body": {"Everything about **the network**."}})
+
+	body := get(t, h, "/view/DNS").Body.String()
+	assert.NotContains(t, body, "tags:")
+	assert.NotContains(t, body, "Category:Runbooks")
+	assert.Contains(t, body, `<a href="/category/Networking">Networking</a> | <a href="/category/Runbooks">Runbooks</a>`)
+
+	rec := get(t, h, "/category/Networking")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body = rec.Body.String()
+	assert.Contains(t, body, "<strong>the network</strong>")
+	assert.Contains(t, body, `<li><a href="/view/DNS">DNS</a></li>`)
+	assert.Contains(t, body, `<li><a href="/view/Firewall">Firewall</a></li>`)
+
+	assert.Contains(t, get(t, h, "/category/").Body.String(), `<a href="/category/Networking">Networking</a> (2 pages)`)
+	assert.Equal(t, http.StatusMovedPermanently, get(t, h, "/category/Networking%20").Code)
+
+	// Membership follows edits and deletes
+	post(t, h, "/save/Firewall", url.Values{"body": {"Rules.\n\n[[Category:Security]]"}, "base": {"1"}})
+	post(t, h, "/delete/DNS", url.Values{"base": {"1"}})
+	assert.Empty(t, h.categoryIndex().backlinks("Networking"))
+	assert.Equal(t, []string{"Firewall"}, h.categoryIndex().backlinks("Security"))
+
+	rec = apiRequest(t, h, http.MethodGet, "/api/v1/pages/Firewall", "")
+	var p apiPageJSON
+	json.NewDecoder(rec.Body).Decode(&p)
+	assert.Equal(t, []string{"Security"}, p.Categories)
+}
+
+func TestCategoryListsOnlyReadablePages(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin := loginAs(t, wk, "admin")
+	as(t, wk, admin, http.MethodPost, "/save/Secret", url.Values{"body": {"[[Category:Keys]]"}})
+	as(t, wk, admin, http.MethodPost, "/save/Notes", url.Values{"body": {"[[Category:Keys]]"}})
+
+	body := get(t, wk, "/category/Keys").Body.String()
+	assert.Contains(t, body, "Notes")
+	assert.NotContains(t, body, "Secret")
+	assert.Contains(t, get(t, wk, "/category/").Body.String(), "(1 page)")
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// errEditConflict means the page changed after the edit being saved was started
+var errEditConflict = errors.New("edit conflict: the page was changed by someone else")
+
+// anyRevision saves or deletes a page without checking which revision the change was based on
+const anyRevision = -1
+
+// checkBase rejects a change based on a revision other than the current one; base 0 means
+// the page must not exist yet
+func checkBase(history []Revision, base int) error {
+	if base != anyRevision && base != len(history) {
+		return errEditConflict
+	}
+	return nil
+}
+
+// etag is the entity tag of a page revision, used by the edit form and the JSON API
+func etag(revision int) string {
+	return strconv.Quote(strconv.Itoa(revision))
+}
+
+// ifMatch returns the revision the If-Match header requires. A missing header allows any
+// revision, "*" requires the page to exist and a tag that is not one of ours matches nothing.
+func ifMatch(r *http.Request, current int) int {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return anyRevision
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" && current > 0 {
+			return current
+		}
+		// If-Match uses strong comparison, so weak tags never match
+		if n, err := strconv.Unquote(tag); err == nil {
+			if rev, err := strconv.Atoi(n); err == nil && rev == current {
+				return rev
+			}
+		}
+	}
+	return current + 1 // a revision that can never be the current one
+}
+
+// formBase reads the revision an edit form was loaded at
+func formBase(r *http.Request) int {
+	base, err := strconv.Atoi(r.FormValue("base"))
+	if err != nil {
+		return anyRevision
+	}
+	return base
+}
+
+type conflictView struct {
+	Title   string
+	Current *Page  // the version saved by someone else
+	Mine    []byte // the body that failed to save
+	Summary string
+	Author  string
+	Unified []diffLine
+}
+
+// renderConflict shows the saved and submitted versions side by side so the editor can merge them
+func (wk *Wiki) renderConflict(w http.ResponseWriter, r *http.Request, current *Page, mine []byte) {
+	unified, _ := diffBodies(current.Body, mine)
+	wk.renderTemplateStatus(w, r, http.StatusConflict, "conflict", &conflictView{
+		Title:   current.Title,
+		Current: current,
+		Mine:    mine,
+		Summary: r.FormValue("summary"),
+		Author:  r.FormValue("author"),
+		Unified: unified,
+	})
+}
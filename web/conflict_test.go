@@ -0,0 +1,102 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEditFormCarriesBaseRevision(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"v1"}})
+
+	rec := get(t, h, "/edit/Home")
+	assert.Contains(t, rec.Body.String(), `<input type="hidden" name="base" value="1">`)
+	rec = get(t, h, "/edit/New")
+	assert.Contains(t, rec.Body.String(), `<input type="hidden" name="base" value="0">`)
+}
+
+func TestStaleSaveShowsConflict(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"original"}, "base": {"0"}})
+	// Alice and Bob both open revision 1; Alice saves first
+	assert.Equal(t, http.StatusFound, post(t, h, "/save/Home", url.Values{"body": {"alice's text"}, "base": {"1"}}).Code)
+
+	rec := post(t, h, "/save/Home", url.Values{"body": {"bob's text"}, "base": {"1"}, "summary": {"bob edit"}})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "Edit conflict")
+	assert.Contains(t, body, "alice&#39;s text")
+	assert.Contains(t, body, "bob&#39;s text")
+	assert.Contains(t, body, `<input type="hidden" name="base" value="2">`)
+	assert.Contains(t, body, `value="bob edit"`)
+
+	p, _ := h.loadPage("Home")
+	assert.Equal(t, "alice's text", string(p.Body))
+
+	// Resubmitting on top of the current revision succeeds
+	assert.Equal(t, http.StatusFound, post(t, h, "/save/Home", url.Values{"body": {"merged"}, "base": {"2"}}).Code)
+}
+
+func TestCreatingExistingPageConflicts(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"first"}, "base": {"0"}})
+	assert.Equal(t, http.StatusConflict, post(t, h, "/save/Home", url.Values{"body": {"second"}, "base": {"0"}}).Code)
+}
+
+func TestIfMatch(t *testing.T) {
+	header := func(v string) *http.Request {
+		r := httptest.NewRequest(http.MethodPut, "/", nil)
+		if v != "" {
+			r.Header.Set("If-Match", v)
+		}
+		return r
+	}
+	assert.Equal(t, anyRevision, ifMatch(header(""), 3))
+	assert.Equal(t, 3, ifMatch(header(`"3"`), 3))
+	assert.Equal(t, 3, ifMatch(header(`"1", "3"`), 3))
+	assert.Equal(t, 3, ifMatch(header("*"), 3))
+	assert.NotEqual(t, 3, ifMatch(header(`"2"`), 3))
+	assert.NotEqual(t, 3, ifMatch(header(`W/"3"`), 3))
+	assert.NotEqual(t, 0, ifMatch(header("*"), 0))
+}
+
+func TestAPIIfMatch(t *testing.T) {
+	h := newTestWiki(t)
+	rec := apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":"Home","body":"v1"}`)
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+
+	rec = apiRequest(t, h, http.MethodGet, "/api/v1/pages/Home", "")
+	tag := rec.Header().Get("ETag")
+	assert.Equal(t, `"1"`, tag)
+
+	put := func(match, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/pages/Home", strings.NewReader(body))
+		req.Header.Set("If-Match", match)
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	rec = put(tag, `{"body":"v2"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+
+	// The same tag is now stale
+	assert.Equal(t, http.StatusPreconditionFailed, put(tag, `{"body":"v3"}`).Code)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/pages/Home", nil)
+	req.Header.Set("If-Match", tag)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+
+	req.Header.Set("If-Match", `"2"`)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+}
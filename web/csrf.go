@@ -0,0 +1,110 @@
+package web
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"regexp"
+)
+
+const (
+	csrfField  = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+	// csrfCookie identifies visitors without a login session so their forms can be protected too
+	csrfCookie = "wiki_csrf"
+)
+
+// postForm matches the opening tag of every form that submits by POST
+var postForm = regexp.MustCompile(`(?i)<form\b[^>]*\bmethod="post"[^>]*>`)
+
+// newSecretKey returns a random key for signing with HMAC
+func newSecretKey() []byte {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("error generating secret key: " + err.Error())
+	}
+	return key
+}
+
+// csrfTokenFor derives the token for a session; tokens need no storage and die with the session
+func (wk *Wiki) csrfTokenFor(id string) string {
+	mac := hmac.New(sha256.New, wk.csrfKey)
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// csrfSession returns the value the CSRF token of a request is bound to:
+// the login session if there is one, else the anonymous visitor cookie
+func csrfSession(r *http.Request) string {
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		if c, err := r.Cookie(name); err == nil && c.Value != "" {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// csrfToken returns the token to embed in forms, giving new visitors a cookie to bind it to
+func (wk *Wiki) csrfToken(w http.ResponseWriter, r *http.Request) string {
+	id := csrfSession(r)
+	if id == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return ""
+		}
+		id = base64.RawURLEncoding.EncodeToString(b)
+		http.SetCookie(w, &http.Cookie{
+			Name:     csrfCookie,
+			Value:    id,
+			Path:     "/",
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return wk.csrfTokenFor(id)
+}
+
+// validCSRF reports whether a request carries the token of its session in the form or header
+func (wk *Wiki) validCSRF(r *http.Request) bool {
+	id := csrfSession(r)
+	if id == "" {
+		return false
+	}
+	token := r.Header.Get(csrfHeader)
+	if token == "" {
+		token = r.PostFormValue(csrfField)
+	}
+	return hmac.Equal([]byte(token), []byte(wk.csrfTokenFor(id)))
+}
+
+// protect only lets through POST requests carrying a valid CSRF token,
+// so pages can neither be changed by a link nor by a form on another site
+func (wk *Wiki) protect(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !wk.validCSRF(r) {
+			csrfError(w)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func csrfError(w http.ResponseWriter) {
+	http.Error(w, "invalid or missing CSRF token, reload the page and try again", http.StatusForbidden)
+}
+
+// isJSON reports whether a request declares a JSON body. Browsers cannot send that
+// cross-site without a CORS preflight, which protects the API without tokens.
+func isJSON(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == "application/json"
+}
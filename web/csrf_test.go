@@ -0,0 +1,127 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormsCarryCSRFToken(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"hello"}})
+
+	// A first-time visitor gets a cookie the token is bound to
+	rec := get(t, h, "/edit/Home")
+	cookies := rec.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+	assert.Equal(t, csrfCookie, cookies[0].Name)
+	token := h.csrfTokenFor(cookies[0].Value)
+	assert.Contains(t, rec.Body.String(), `<form action="/save/Home" method="POST"><input type="hidden" name="csrf_token" value="`+token+`">`)
+
+	// Every POST form on the page gets one: the delete button and the upload form
+	assert.Equal(t, 2, strings.Count(get(t, h, "/view/Home").Body.String(), `name="csrf_token"`))
+
+	// Returning visitors keep their cookie, so tokens in other open tabs stay valid
+	req := httptest.NewRequest(http.MethodGet, "/edit/Home", nil)
+	req.AddCookie(testVisitor)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Empty(t, rec.Result().Cookies())
+	assert.Contains(t, rec.Body.String(), h.csrfTokenFor(testVisitor.Value))
+}
+
+func TestStateChangesRequireCSRFToken(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"original"}})
+
+	forged := func(method, path string, form url.Values, c *http.Cookie) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c != nil {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	body := url.Values{"body": {"defaced"}}
+	assert.Equal(t, http.StatusForbidden, forged(http.MethodPost, "/save/Home", body, nil))
+	assert.Equal(t, http.StatusForbidden, forged(http.MethodPost, "/save/Home", body, testVisitor))
+	assert.Equal(t, http.StatusForbidden, forged(http.MethodPost, "/save/Home",
+		url.Values{"body": {"defaced"}, csrfField: {h.csrfTokenFor("someone else")}}, testVisitor))
+	assert.Equal(t, http.StatusForbidden, forged(http.MethodPost, "/revert/Home/1", nil, testVisitor))
+	assert.Equal(t, http.StatusForbidden, forged(http.MethodPost, "/delete/Home", nil, testVisitor))
+
+	// State never changes on GET, even with a valid token
+	query := url.Values{csrfField: {h.csrfTokenFor(testVisitor.Value)}, "body": {"defaced"}}
+	assert.Equal(t, http.StatusMethodNotAllowed, forged(http.MethodGet, "/save/Home?"+query.Encode(), nil, testVisitor))
+	assert.Equal(t, http.StatusMethodNotAllowed, forged(http.MethodGet, "/delete/Home?"+query.Encode(), nil, testVisitor))
+
+	p, err := h.loadPage("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, "original", string(p.Body))
+
+	// The token may also come in a header, for scripts
+	req := httptest.NewRequest(http.MethodPost, "/save/Home", strings.NewReader(body.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set(csrfHeader, h.csrfTokenFor(testVisitor.Value))
+	req.AddCookie(testVisitor)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusFound, rec.Code)
+}
+
+func TestDeletePage(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"v1"}})
+	post(t, h, "/save/Home", url.Values{"body": {"v2"}})
+
+	assert.Equal(t, http.StatusConflict, post(t, h, "/delete/Home", url.Values{"base": {"1"}}).Code)
+	assert.Equal(t, http.StatusFound, post(t, h, "/delete/Home", url.Values{"base": {"2"}}).Code)
+	assert.False(t, h.pageExists("Home"))
+	assert.Equal(t, http.StatusNotFound, post(t, h, "/delete/Home", url.Values{"base": {"2"}}).Code)
+}
+
+func TestLoginAndAdminRequireCSRFToken(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader("name=editor&password=pw"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	wk.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// After logging in, tokens are bound to the session instead
+	admin := loginAs(t, wk, "admin")
+	rec = as(t, wk, admin, http.MethodGet, "/admin", nil)
+	assert.Contains(t, rec.Body.String(), wk.csrfTokenFor(admin.Value))
+	assert.NotContains(t, rec.Body.String(), wk.csrfTokenFor(testVisitor.Value))
+
+	req = httptest.NewRequest(http.MethodPost, "/admin", strings.NewReader("action=delete&name=editor"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(admin)
+	rec = httptest.NewRecorder()
+	wk.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, 3, len(wk.auth.Users()))
+}
+
+func TestAPIRequiresJSON(t *testing.T) {
+	h := newTestWiki(t)
+	// A cross-site form can POST text/plain, but never application/json
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/pages", strings.NewReader(`{"title":"Home","body":"x"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	assert.False(t, h.pageExists("Home"))
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/pages", strings.NewReader(`{"title":"Home","body":"x"}`))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
@@ -0,0 +1,323 @@
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffInsert
+	diffDelete
+)
+
+// diffEdit is a single step of an edit script turning one token sequence into another
+type diffEdit struct {
+	Op   diffOp
+	Text string
+}
+
+// maxDiffWork bounds the steps diffTokens spends looking for a minimal script, so two large,
+// very different revisions cannot tie up the server; past it the remaining changes are shown
+// as whole deletions and insertions
+const maxDiffWork = 10_000_000
+
+// diffTokens computes an edit script from a to b with Myers' algorithm in linear space. The script
+// is minimal unless maxDiffWork runs out. Within each run of changes, deletions come first.
+func diffTokens(a, b []string) []diffEdit {
+	d := &differ{work: maxDiffWork}
+	d.compare(a, b)
+	// Order each run of changes as deletions followed by insertions
+	edits := d.edits
+	for i := 0; i < len(edits); {
+		if edits[i].Op == diffEqual {
+			i++
+			continue
+		}
+		j := i
+		for j < len(edits) && edits[j].Op != diffEqual {
+			j++
+		}
+		slices.SortStableFunc(edits[i:j], func(x, y diffEdit) int { return int(y.Op) - int(x.Op) })
+		i = j
+	}
+	return edits
+}
+
+// differ collects the edit script of diffTokens
+type differ struct {
+	edits []diffEdit
+	work  int
+}
+
+func (d *differ) emit(op diffOp, tokens []string) {
+	for _, t := range tokens {
+		d.edits = append(d.edits, diffEdit{op, t})
+	}
+}
+
+// compare appends the edits turning a into b
+func (d *differ) compare(a, b []string) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	d.emit(diffEqual, a[:prefix])
+	a, b = a[prefix:], b[prefix:]
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	if x, y, ok := d.bisect(a, b); ok {
+		d.compare(a[:x], b[:y])
+		d.compare(a[x:], b[y:])
+	} else {
+		d.emit(diffDelete, a)
+		d.emit(diffInsert, b)
+	}
+	d.emit(diffEqual, common)
+}
+
+// bisect finds a point on a shortest edit path from a to b by searching forwards and backwards
+// until the two searches meet. It reports false if either is empty or the work budget runs out.
+func (d *differ) bisect(a, b []string) (int, int, bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return 0, 0, false
+	}
+	maxD := (n + m + 1) / 2
+	// forward[k] is the furthest x reached on diagonal k = x-y from the start; backward[k] likewise
+	// from the end, in coordinates counted back from it
+	offset := maxD + 1
+	forward := make([]int, 2*offset+1)
+	backward := make([]int, 2*offset+1)
+	delta := n - m
+	odd := delta%2 != 0
+	for D := 0; D <= maxD; D++ {
+		if d.work -= 2 * (D + 1); d.work < 0 {
+			return 0, 0, false
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if back := delta - k; odd && back >= -(D-1) && back <= D-1 && x+backward[offset+back] >= n {
+				return x, y, true
+			}
+		}
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-1-x] == b[m-1-y] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if front := delta - k; !odd && front >= -D && front <= D && forward[offset+front]+x >= n {
+				return n - x, m - y, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// diffSegment is a run of text within a line; Changed marks words that differ
+type diffSegment struct {
+	Text    string
+	Changed bool
+}
+
+// diffLine is one rendered line of a diff
+type diffLine struct {
+	Op       string // "equal", "insert" or "delete"
+	OldNo    int    // line number in the old body, 0 for insertions
+	NewNo    int    // line number in the new body, 0 for deletions
+	Segments []diffSegment
+}
+
+// diffRow pairs the old and new sides of a side-by-side diff; either side may be nil
+type diffRow struct {
+	Left  *diffLine
+	Right *diffLine
+}
+
+func splitLines(body []byte) []string {
+	s := strings.ReplaceAll(string(body), "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+var wordToken = regexp.MustCompile(`\s+|[^\s]+`)
+
+// wordDiff highlights the words that differ between a deleted line and the line replacing it
+func wordDiff(old, new string) (oldSegs, newSegs []diffSegment) {
+	for _, e := range diffTokens(wordToken.FindAllString(old, -1), wordToken.FindAllString(new, -1)) {
+		switch e.Op {
+		case diffEqual:
+			oldSegs = appendSegment(oldSegs, e.Text, false)
+			newSegs = appendSegment(newSegs, e.Text, false)
+		case diffDelete:
+			oldSegs = appendSegment(oldSegs, e.Text, true)
+		case diffInsert:
+			newSegs = appendSegment(newSegs, e.Text, true)
+		}
+	}
+	return oldSegs, newSegs
+}
+
+// appendSegment merges adjacent segments with the same state to keep the markup small
+func appendSegment(segs []diffSegment, text string, changed bool) []diffSegment {
+	if n := len(segs); n > 0 && segs[n-1].Changed == changed {
+		segs[n-1].Text += text
+		return segs
+	}
+	return append(segs, diffSegment{text, changed})
+}
+
+// diffBodies returns the unified and side-by-side views of the changes from old to new
+func diffBodies(old, new []byte) (unified []diffLine, rows []diffRow) {
+	edits := diffTokens(splitLines(old), splitLines(new))
+	oldNo, newNo := 0, 0
+	for k := 0; k < len(edits); {
+		if edits[k].Op == diffEqual {
+			oldNo++
+			newNo++
+			line := diffLine{"equal", oldNo, newNo, []diffSegment{{edits[k].Text, false}}}
+			unified = append(unified, line)
+			rows = append(rows, diffRow{&line, &line})
+			k++
+			continue
+		}
+
+		// Collect a hunk of consecutive deletions and insertions
+		var dels, ins []diffLine
+		for ; k < len(edits) && edits[k].Op != diffEqual; k++ {
+			if edits[k].Op == diffDelete {
+				oldNo++
+				dels = append(dels, diffLine{"delete", oldNo, 0, []diffSegment{{edits[k].Text, true}}})
+			} else {
+				newNo++
+				ins = append(ins, diffLine{"insert", 0, newNo, []diffSegment{{edits[k].Text, true}}})
+			}
+		}
+		// Lines replaced one-for-one get word-level highlighting
+		for i := 0; i < min(len(dels), len(ins)); i++ {
+			dels[i].Segments, ins[i].Segments = wordDiff(dels[i].Segments[0].Text, ins[i].Segments[0].Text)
+		}
+		unified = append(unified, dels...)
+		unified = append(unified, ins...)
+		for i := 0; i < max(len(dels), len(ins)); i++ {
+			var row diffRow
+			if i < len(dels) {
+				row.Left = &dels[i]
+			}
+			if i < len(ins) {
+				row.Right = &ins[i]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return unified, rows
+}
+
+type diffView struct {
+	Title   string
+	From    int
+	To      int
+	Mode    string
+	Unified []diffLine
+	Rows    []diffRow
+}
+
+// revisionBody loads the body of a revision; revision 0 is the empty page before the first save
+func (wk *Wiki) revisionBody(title string, id int) ([]byte, error) {
+	if id == 0 {
+		return nil, nil
+	}
+	rev, err := wk.loadRevision(title, id)
+	if err != nil {
+		return nil, err
+	}
+	return rev.Body, nil
+}
+
+// diffHandler compares two revisions; to defaults to the latest and from to the one before it
+func (wk *Wiki) diffHandler(w http.ResponseWriter, r *http.Request, title string) {
+	revs, err := wk.store.History(title)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(revs) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+	to := len(revs)
+	if v := q.Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid revision", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to - 1
+	if v := q.Get("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid revision", http.StatusBadRequest)
+			return
+		}
+	}
+
+	old, err := wk.revisionBody(title, from)
+	if err != nil {
+		revisionError(w, r, err)
+		return
+	}
+	new, err := wk.revisionBody(title, to)
+	if err != nil {
+		revisionError(w, r, err)
+		return
+	}
+	mode := "unified"
+	if q.Get("mode") == "side" {
+		mode = "side"
+	}
+	unified, rows := diffBodies(old, new)
+	wk.renderTemplate(w, r, "diff", &diffView{title, from, to, mode, unified, rows})
+}
+
+// revisionError reports a missing revision as 404 and anything else as a server error
+func revisionError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffTokens(t *testing.T) {
+	edits := diffTokens([]string{"a", "b", "c"}, []string{"a", "x", "c", "d"})
+	assert.Equal(t, []diffEdit{
+		{diffEqual, "a"},
+		{diffDelete, "b"},
+		{diffInsert, "x"},
+		{diffEqual, "c"},
+		{diffInsert, "d"},
+	}, edits)
+}
+
+func TestDiffTokensLargeInput(t *testing.T) {
+	// Two unrelated 8,000 line revisions used to need a 64M entry table
+	var a, b []string
+	for i := range 8000 {
+		a = append(a, "old "+strconv.Itoa(i))
+		b = append(b, "new "+strconv.Itoa(i%7))
+	}
+	b[4000] = a[4000]
+	edits := diffTokens(a, b)
+
+	var gotA, gotB []string
+	for _, e := range edits {
+		if e.Op != diffInsert {
+			gotA = append(gotA, e.Text)
+		}
+		if e.Op != diffDelete {
+			gotB = append(gotB, e.Text)
+		}
+	}
+	assert.Equal(t, a, gotA)
+	assert.Equal(t, b, gotB)
+}
+
+func TestDiffBodies(t *testing.T) {
+	unified, rows := diffBodies([]byte("one\nthe quick fox\nthree\n"), []byte("one\nthe slow fox\nthree\nfour\n"))
+
+	assert.Equal(t, 5, len(unified))
+	assert.Equal(t, "delete", unified[1].Op)
+	assert.Equal(t, []diffSegment{{"the ", false}, {"quick", true}, {" fox", false}}, unified[1].Segments)
+	assert.Equal(t, "insert", unified[2].Op)
+	assert.Equal(t, []diffSegment{{"the ", false}, {"slow", true}, {" fox", false}}, unified[2].Segments)
+	assert.Equal(t, 4, unified[4].NewNo)
+
+	assert.Equal(t, 4, len(rows))
+	assert.Equal(t, "delete", rows[1].Left.Op)
+	assert.Equal(t, "insert", rows[1].Right.Op)
+	assert.Nil(t, rows[3].Left)
+	assert.Equal(t, "four", rows[3].Right.Segments[0].Text)
+}
+
+func TestDiffHandler(t *testing.T) {
+	h := newTestWiki(t)
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/diff/Home").Code)
+
+	post(t, h, "/save/Home", url.Values{"body": {"hello world"}})
+	post(t, h, "/save/Home", url.Values{"body": {"hello there"}})
+
+	rec := get(t, h, "/diff/Home")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<del>world</del>")
+	assert.Contains(t, rec.Body.String(), "<ins>there</ins>")
+
+	rec = get(t, h, "/diff/Home?from=0&to=1&mode=side")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<ins>hello world</ins>")
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/diff/Home?from=1&to=7").Code)
+	assert.Equal(t, http.StatusBadRequest, get(t, h, "/diff/Home?from=a").Code)
+}
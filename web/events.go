@@ -0,0 +1,175 @@
+package web
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	eventBuffer       = 16               // events a stream may fall behind before it is dropped
+	eventRetry        = 5 * time.Second  // how long browsers wait before reconnecting a dropped stream
+	eventWriteTimeout = 10 * time.Second // how long one write to a stream may take
+)
+
+// eventHeartbeat is how often an idle stream gets a comment, so proxies keep it open and
+// clients that went away are noticed
+var eventHeartbeat = 30 * time.Second
+
+// eventsWorker is the shared worker view.html follows page events through, so all tabs share one stream
+//
+//go:embed events.js
+var eventsWorker []byte
+
+// pageEvent tells streams that a page changed
+type pageEvent struct {
+	Type     string `json:"type"` // "saved", "moved" or "deleted"
+	Title    string `json:"title"`
+	To       string `json:"to,omitempty"`  // the new title of a moved page
+	URL      string `json:"url,omitempty"` // where the page can be read now
+	Revision int    `json:"revision,omitempty"`
+	Author   string `json:"author,omitempty"`
+}
+
+// eventHub fans page events out to the open streams. Publishing never blocks: a stream
+// that falls too far behind is closed, and its browser reconnects.
+type eventHub struct {
+	mu     sync.Mutex
+	subs   map[chan pageEvent]bool
+	closed bool
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{subs: map[chan pageEvent]bool{}}
+}
+
+// subscribe returns a channel receiving every event until unsubscribe or close,
+// or false once the hub is closed
+func (h *eventHub) subscribe() (chan pageEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil, false
+	}
+	ch := make(chan pageEvent, eventBuffer)
+	h.subs[ch] = true
+	return ch, true
+}
+
+func (h *eventHub) unsubscribe(ch chan pageEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[ch] {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (h *eventHub) publish(e pageEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// close ends every stream and refuses new ones, so a server shutdown does not wait on them
+func (h *eventHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for ch := range h.subs {
+		delete(h.subs, ch)
+		close(ch)
+	}
+}
+
+func (wk *Wiki) publishSaved(p *Page, author string) {
+	wk.events.publish(pageEvent{Type: "saved", Title: p.Title, URL: "/view/" + slug(p.Title), Revision: p.Revision, Author: author})
+}
+
+func (wk *Wiki) publishMoved(from, to, author string) {
+	wk.events.publish(pageEvent{Type: "moved", Title: from, To: to, URL: "/view/" + slug(to), Author: author})
+}
+
+func (wk *Wiki) publishDeleted(title string) {
+	wk.events.publish(pageEvent{Type: "deleted", Title: title})
+}
+
+func eventsWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Write(eventsWorker)
+}
+
+// eventsHandler streams the changes to every page the requester may read
+func (wk *Wiki) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	wk.streamEvents(w, r, func(pageEvent) bool { return true })
+}
+
+// pageEventsHandler streams the changes to one page, including it being moved there
+func (wk *Wiki) pageEventsHandler(w http.ResponseWriter, r *http.Request, title string) {
+	wk.streamEvents(w, r, func(e pageEvent) bool { return e.Title == title || e.To == title })
+}
+
+// streamEvents writes the events passing match as Server-Sent Events until the client goes away
+// or the server shuts down. Events about pages the requester may not read are left out.
+func (wk *Wiki) streamEvents(w http.ResponseWriter, r *http.Request, match func(pageEvent) bool) {
+	ch, ok := wk.events.subscribe()
+	if !ok {
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	defer wk.events.unsubscribe(ch)
+
+	rc := http.NewResponseController(w)
+	send := func(format string, args ...any) bool {
+		// Each write gets its own deadline in place of the server's WriteTimeout, which would
+		// otherwise end every stream after a few seconds. Writers without deadlines are fine too.
+		rc.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx would hold the events back otherwise
+	if !send("retry: %d\n\n", eventRetry.Milliseconds()) {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if !send(": ping\n\n") {
+				return
+			}
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if !match(e) || !wk.allowed(r, e.Title, readAccess) {
+				continue
+			}
+			if e.To != "" && !wk.allowed(r, e.To, readAccess) {
+				e.To, e.URL = "", ""
+			}
+			data, err := json.Marshal(e)
+			if err != nil || !send("event: %s\ndata: %s\n\n", e.Type, data) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// A shared worker keeping one /events stream for every open wiki tab. Browsers allow only a few
+// connections per host over HTTP/1.1, so a stream per tab would leave no room for loading pages.
+// Tabs post {title} to follow a page and {close: true} when they go away.
+var ports = [];
+var source = null;
+
+function forward(e) {
+	var ev = JSON.parse(e.data);
+	ports.forEach(function (port) {
+		if (port.title === ev.title || port.title === ev.to) {
+			port.postMessage(ev);
+		}
+	});
+}
+
+onconnect = function (e) {
+	var port = e.ports[0];
+	port.onmessage = function (m) {
+		if (m.data.close) {
+			ports = ports.filter(function (p) { return p !== port; });
+			if (ports.length === 0 && source) {
+				source.close();
+				source = null;
+			}
+			return;
+		}
+		port.title = m.data.title;
+		if (ports.indexOf(port) < 0) {
+			ports.push(port);
+		}
+		if (!source) {
+			source = new EventSource("/events");
+			["saved", "moved", "deleted"].forEach(function (type) {
+				source.addEventListener(type, forward);
+			});
+		}
+	};
+};
@@ -0,0 +1,152 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// eventStream reads Server-Sent Events from a response
+type eventStream struct {
+	t *testing.T
+	r *bufio.Reader
+}
+
+// openEvents connects to an event stream and waits until it is subscribed
+func openEvents(t *testing.T, client *http.Client, url string) (*http.Response, *eventStream) {
+	t.Helper()
+	rsp, err := client.Get(url)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	assert.Equal(t, "text/event-stream", rsp.Header.Get("Content-Type"))
+	s := &eventStream{t: t, r: bufio.NewReader(rsp.Body)}
+	assert.Equal(t, "retry: 5000", s.line())
+	assert.Equal(t, "", s.line())
+	return rsp, s
+}
+
+func (s *eventStream) line() string {
+	s.t.Helper()
+	line, err := s.r.ReadString('\n')
+	assert.NoError(s.t, err)
+	return strings.TrimSuffix(line, "\n")
+}
+
+// next returns the name and data of the next event
+func (s *eventStream) next() (string, pageEvent) {
+	s.t.Helper()
+	name := strings.TrimPrefix(s.line(), "event: ")
+	var e pageEvent
+	assert.NoError(s.t, json.Unmarshal([]byte(strings.TrimPrefix(s.line(), "data: ")), &e))
+	assert.Equal(s.t, "", s.line())
+	return name, e
+}
+
+func TestPageEvents(t *testing.T) {
+	wk := newTestWiki(t)
+	srv := httptest.NewServer(wk)
+	defer srv.Close()
+
+	rsp, home := openEvents(t, srv.Client(), srv.URL+"/events/Home")
+	defer rsp.Body.Close()
+	rsp, all := openEvents(t, srv.Client(), srv.URL+"/events")
+	defer rsp.Body.Close()
+
+	post(t, wk, "/save/Other", url.Values{"body": {"x"}})
+	post(t, wk, "/save/Home", url.Values{"body": {"first"}, "author": {"ann"}})
+	post(t, wk, "/move/Home", url.Values{"to": {"Start"}, "base": {"1"}})
+	post(t, wk, "/delete/Other", url.Values{"base": {"1"}})
+
+	// The page stream skips other pages
+	name, e := home.next()
+	assert.Equal(t, "saved", name)
+	assert.Equal(t, pageEvent{Type: "saved", Title: "Home", URL: "/view/Home", Revision: 1, Author: "ann"}, e)
+	name, e = home.next()
+	assert.Equal(t, "moved", name)
+	assert.Equal(t, "Start", e.To)
+	assert.Equal(t, "/view/Start", e.URL)
+
+	var names []string
+	for range 5 {
+		name, e := all.next()
+		names = append(names, name+" "+e.Title)
+	}
+	assert.Equal(t, []string{"saved Other", "saved Home", "saved Start", "moved Home", "deleted Other"}, names)
+}
+
+func TestPageEventsAccess(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin := loginAs(t, wk, "admin")
+	srv := httptest.NewServer(wk)
+	defer srv.Close()
+
+	rec := as(t, wk, nil, http.MethodGet, "/events/Secret", nil)
+	assert.Equal(t, http.StatusFound, rec.Code, "sent to log in")
+
+	rsp, all := openEvents(t, srv.Client(), srv.URL+"/events")
+	defer rsp.Body.Close()
+	as(t, wk, admin, http.MethodPost, "/save/Secret", url.Values{"body": {"x"}})
+	as(t, wk, admin, http.MethodPost, "/save/Home", url.Values{"body": {"x"}})
+	_, e := all.next()
+	assert.Equal(t, "Home", e.Title)
+}
+
+func TestViewUpdateBanner(t *testing.T) {
+	wk := newTestWiki(t)
+	post(t, wk, "/save/Run_book", url.Values{"body": {"first"}})
+	post(t, wk, "/save/Run_book", url.Values{"body": {"second"}})
+
+	body := get(t, wk, "/view/Run_book").Body.String()
+	assert.Contains(t, body, `<p id="wiki-updated" hidden>`)
+	assert.Contains(t, body, `new EventSource("/events/Run_book")`)
+	assert.Contains(t, body, `revision =  2 ;`)
+	assert.Contains(t, body, `new SharedWorker("/events.js")`)
+	assert.Contains(t, body, `title = "Run book"`)
+	assert.NotContains(t, get(t, wk, "/view/Run_book?rev=1").Body.String(), "EventSource")
+
+	// Headings cannot take the banner's id
+	post(t, wk, "/save/Run_book", url.Values{"body": {"## Updated\n\n## Wiki updated\n"}})
+	body = get(t, wk, "/view/Run_book").Body.String()
+	assert.Contains(t, body, `<h2 id="updated">`)
+	assert.Contains(t, body, `<h2 id="wiki-updated-2">`)
+	assert.Equal(t, 1, strings.Count(body, `id="wiki-updated"`))
+
+	rec := get(t, wk, "/events.js")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/javascript; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `new EventSource("/events")`)
+}
+
+func TestShutdownClosesEventStreams(t *testing.T) {
+	s, err := NewServer(Config{Addr: "127.0.0.1:0", DataDir: t.TempDir(), WriteTimeout: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	l, err := net.Listen("tcp", s.Addr)
+	assert.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+
+	rsp, events := openEvents(t, http.DefaultClient, "http://"+l.Addr().String()+"/events")
+	defer rsp.Body.Close()
+
+	// The stream outlives the server's WriteTimeout
+	time.Sleep(300 * time.Millisecond)
+	post(t, s.Wiki, "/save/Home", url.Values{"body": {"x"}})
+	_, e := events.next()
+	assert.Equal(t, "Home", e.Title)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	assert.NoError(t, <-done)
+	_, err = events.r.ReadString('\n')
+	assert.Error(t, err, "the stream ended")
+}
@@ -0,0 +1,203 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// exportedPage is one entry of the search.json written by Export
+type exportedPage struct {
+	Title string `json:"title"`
+	URL   string `json:"url"` // relative to the export directory
+	Text  string `json:"text"`
+}
+
+// export holds the output path of every page and attachment while a static site is written
+type export struct {
+	dir   string
+	pages map[string]string    // title to path, e.g. "Team/Infra/Runbook.html"
+	files map[[2]string]string // title and attachment name to path
+}
+
+// exportPath turns a title into a relative path with one directory per namespace. Each segment
+// is escaped like a storage key, so the files are safe on any file system.
+func exportPath(title string) string {
+	segments := strings.Split(title, "/")
+	for i, s := range segments {
+		segments[i] = storageKey(s)
+	}
+	return path.Join(segments...)
+}
+
+// exportFileName escapes an attachment name but keeps its extension, which is all a browser
+// reading from disk has to go on
+func exportFileName(name string) string {
+	ext := path.Ext(name)
+	if ext == "" {
+		return storageKey(name)
+	}
+	return storageKey(strings.TrimSuffix(name, ext)) + "." + storageKey(ext[1:])
+}
+
+// relativeURL links the file at from to the file at to, both relative to the export directory
+func relativeURL(from, to string) string {
+	segments := strings.Split(to, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Repeat("../", strings.Count(from, "/")) + strings.Join(segments, "/")
+}
+
+var (
+	linkAttr = regexp.MustCompile(`\s(href|src)="(/[^"]*)"`)
+	tags     = regexp.MustCompile(`<[^>]*>`)
+)
+
+// rewrite points the wiki's links in out at the exported files. Links to anything that is not
+// part of the export, like edit forms or missing pages, lose their target.
+func (e *export) rewrite(from string, out []byte) []byte {
+	return linkAttr.ReplaceAllFunc(out, func(m []byte) []byte {
+		sub := linkAttr.FindSubmatch(m)
+		u, err := url.Parse(html.UnescapeString(string(sub[2])))
+		if err != nil {
+			return nil
+		}
+		target, ok := "", false
+		switch {
+		case u.Path == "/":
+			target, ok = "index.html", true
+		case strings.HasPrefix(u.Path, "/view/"):
+			if title, valid := normalizeTitle(strings.TrimPrefix(u.Path, "/view/")); valid {
+				target, ok = e.pages[title]
+			}
+		case strings.HasPrefix(u.Path, "/files/"):
+			if title, name, valid := splitFilePath(strings.TrimPrefix(u.Path, "/files/")); valid {
+				target, ok = e.files[[2]string{title, name}]
+			}
+		}
+		if !ok {
+			return nil
+		}
+		link := relativeURL(from, target)
+		if u.Fragment != "" {
+			link += "#" + u.EscapedFragment()
+		}
+		return []byte(fmt.Sprintf(` %s="%s"`, sub[1], html.EscapeString(link)))
+	})
+}
+
+// write saves a generated HTML document, adding what a browser needs to read it from disk
+func (e *export) write(name, title string, body []byte) error {
+	var doc bytes.Buffer
+	fmt.Fprintf(&doc, "<!DOCTYPE html>\n<meta charset=\"utf-8\">\n<title>%s</title>\n", html.EscapeString(title))
+	doc.Write(body)
+	return e.writeFile(name, doc.Bytes())
+}
+
+func (e *export) writeFile(name string, data []byte) error {
+	p := filepath.Join(e.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+// Export writes a read-only copy of the wiki to dir as a static site: a page per wiki page,
+// its attachments, index.html listing every page and search.json with the text of each page.
+// Only pages anonymous visitors may read are included. Existing files in dir are overwritten
+// but never removed.
+func (wk *Wiki) Export(dir string) error {
+	// A request without a user, so the access rules of anonymous visitors apply
+	anon := new(http.Request)
+	titles, err := wk.titles(anon)
+	if err != nil {
+		return err
+	}
+
+	e := &export{dir: dir, pages: map[string]string{}, files: map[[2]string]string{}}
+	attachments := map[string][]Attachment{}
+	for _, title := range titles {
+		p := exportPath(title)
+		e.pages[title] = p + ".html"
+		list, err := wk.store.Attachments(title)
+		if err != nil {
+			return err
+		}
+		attachments[title] = list
+		for _, a := range list {
+			e.files[[2]string{title, a.Name}] = "files/" + p + "/" + exportFileName(a.Name)
+		}
+	}
+
+	search := []exportedPage{}
+	for _, title := range titles {
+		p, err := wk.loadPage(title)
+		if err != nil {
+			return err
+		}
+		for _, a := range attachments[title] {
+			_, data, err := wk.store.LoadAttachment(title, a.Name)
+			if err != nil {
+				return err
+			}
+			if err := e.writeFile(e.files[[2]string{title, a.Name}], data); err != nil {
+				return err
+			}
+		}
+
+		name := e.pages[title]
+		if target, ok := redirectTarget(p.Body); ok && e.pages[target] != "" {
+			link := html.EscapeString(relativeURL(name, e.pages[target]))
+			body := fmt.Sprintf("<meta http-equiv=\"refresh\" content=\"0; url=%s\">\n<p>Moved to <a href=\"%s\">%s</a>.</p>\n", link, link, html.EscapeString(target))
+			if err := e.write(name, title, []byte(body)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		v := &pageView{Page: p, Attachments: attachments[title], Static: true}
+		rendered, headings, err := wk.renderPage(anon, title, p.Body)
+		if err != nil {
+			return fmt.Errorf("error rendering %s: %v", title, err)
+		}
+		v.HTML, v.TOC = rendered, wk.tableOfContents(headings)
+		v.Backlinks = wk.readable(anon, wk.linkIndex().backlinks(title))
+		v.Categories = pageCategories(p.Body)
+		var buf bytes.Buffer
+		if err := wk.templates.ExecuteTemplate(&buf, "view.html", v); err != nil {
+			return err
+		}
+		if err := e.write(name, title, e.rewrite(name, buf.Bytes())); err != nil {
+			return err
+		}
+		search = append(search, exportedPage{
+			Title: title,
+			URL:   relativeURL("", name),
+			Text:  strings.Join(strings.Fields(html.UnescapeString(tags.ReplaceAllString(string(v.HTML), " "))), " "),
+		})
+	}
+
+	index := &specialView{Special: &specialPages[0], Items: titleItems(titles), Start: 1, Total: len(titles), Page: 1}
+	var buf bytes.Buffer
+	if err := wk.templates.ExecuteTemplate(&buf, "special.html", index); err != nil {
+		return err
+	}
+	if err := e.write("index.html", index.Special.Heading, e.rewrite("index.html", buf.Bytes())); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(search, "", "  ")
+	if err != nil {
+		return err
+	}
+	return e.writeFile("search.json", data)
+}
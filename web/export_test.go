@@ -0,0 +1,87 @@
+package web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportPaths(t *testing.T) {
+	assert.Equal(t, "Team/Infra/Runbook", exportPath("Team/Infra/Runbook"))
+	assert.Equal(t, "Release_Notes/v1%2E2", exportPath("Release Notes/v1.2"))
+	assert.Equal(t, "Template%3AInfobox", exportPath("Template:Infobox"))
+	assert.Equal(t, "my_diagram.png", exportFileName("my diagram.png"))
+	assert.Equal(t, "v1%2E2%2Etar.gz", exportFileName("v1.2.tar.gz"))
+
+	assert.Equal(t, "../Home.html", relativeURL("Team/Runbook.html", "Home.html"))
+	assert.Equal(t, "Caf%25C3%25A9.html", relativeURL("Home.html", "Caf%C3%A9.html"))
+}
+
+func TestExport(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"See [[Team/Runbook|the runbook]], [[Café]] and [[Missing]].\n\n[[File:Team/Runbook/diagram.png]]"}})
+	post(t, h, "/save/Team/Runbook", url.Values{"body": {"Back [[Home]] & <b>done</b>"}})
+	post(t, h, "/save/Café", url.Values{"body": {"coffee"}})
+	upload(t, h, "Team/Runbook", "diagram.png", pngHeader)
+	post(t, h, "/move/Café", url.Values{"to": {"Coffee"}, "base": {"1"}, "redirect": {"1"}})
+
+	dir := t.TempDir()
+	assert.NoError(t, h.Export(dir))
+
+	home, err := os.ReadFile(filepath.Join(dir, "Home.html"))
+	assert.NoError(t, err)
+	s := string(home)
+	assert.Contains(t, s, `<meta charset="utf-8">`)
+	assert.Contains(t, s, `<a class="wikilink" href="Team/Runbook.html">the runbook</a>`)
+	assert.Contains(t, s, `href="Caf%25C3%25A9.html"`)
+	assert.Contains(t, s, `<a class="wikilink missing" title="Missing (page does not exist)">Missing</a>`)
+	assert.Contains(t, s, `src="files/Team/Runbook/diagram.png"`)
+	assert.NotContains(t, s, "/edit/")
+	assert.NotContains(t, s, "<form")
+
+	runbook, _ := os.ReadFile(filepath.Join(dir, "Team", "Runbook.html"))
+	assert.Contains(t, string(runbook), `href="../Home.html"`)
+	assert.Contains(t, string(runbook), `href="../files/Team/Runbook/diagram.png"`)
+	data, _ := os.ReadFile(filepath.Join(dir, "files", "Team", "Runbook", "diagram.png"))
+	assert.Equal(t, pngHeader, data)
+
+	stub, _ := os.ReadFile(filepath.Join(dir, "Caf%C3%A9.html"))
+	assert.Contains(t, string(stub), `<meta http-equiv="refresh" content="0; url=Coffee.html">`)
+
+	index, _ := os.ReadFile(filepath.Join(dir, "index.html"))
+	assert.Contains(t, string(index), `<a href="Team/Runbook.html">Team/Runbook</a>`)
+
+	var search []exportedPage
+	raw, _ := os.ReadFile(filepath.Join(dir, "search.json"))
+	assert.NoError(t, json.Unmarshal(raw, &search))
+	assert.Equal(t, []string{"Coffee", "Home", "Team/Runbook"}, titlesOfExport(search))
+	assert.Equal(t, exportedPage{Title: "Team/Runbook", URL: "Team/Runbook.html", Text: "Back Home & done"}, search[2])
+}
+
+func titlesOfExport(pages []exportedPage) []string {
+	var titles []string
+	for _, p := range pages {
+		titles = append(titles, p.Title)
+	}
+	return titles
+}
+
+func TestExportLeavesOutRestrictedPages(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin := loginAs(t, wk, "admin")
+	as(t, wk, admin, http.MethodPost, "/save/Notes", url.Values{"body": {"see [[Secret]]"}})
+	as(t, wk, admin, http.MethodPost, "/save/Secret", url.Values{"body": {"hunter2 [[Notes]]"}})
+
+	dir := t.TempDir()
+	assert.NoError(t, wk.Export(dir))
+	assert.FileExists(t, filepath.Join(dir, "Notes.html"))
+	assert.NoFileExists(t, filepath.Join(dir, "Secret.html"))
+	notes, _ := os.ReadFile(filepath.Join(dir, "Notes.html"))
+	assert.NotContains(t, string(notes), `href="Secret.html"`)
+	assert.NotContains(t, string(notes), "What links here")
+}
@@ -0,0 +1,457 @@
+package web
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitStore keeps pages in a local git repository, bare or with a working tree, where every save
+// is a commit. Files are laid out like in a FileStore: <key>.txt for the current body,
+// <key>.rev for its revision number and <key>.files/ for attachments. The history of a page is the log of its file since it was last
+// deleted, with the commit author and message as the revision author and summary.
+//
+// Commits are made with git plumbing against a temporary index, so they never depend on the state
+// of a working tree; in a repository with one, the checked out files are updated afterwards.
+type GitStore struct {
+	Dir  string
+	bare bool
+	mu   sync.Mutex // serializes commits
+}
+
+// NewGitStore opens the git repository at dir, creating a repository with a working tree if dir
+// is not the top of one yet. It needs the git command.
+func NewGitStore(dir string) (*GitStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating repository directory %s: %v", dir, err)
+	}
+	abs, err := filepath.Abs(dir)
+	if err == nil {
+		abs, err = filepath.EvalSymlinks(abs)
+	}
+	if err != nil {
+		return nil, err
+	}
+	g := &GitStore{Dir: abs}
+	// A directory inside some other repository does not count
+	if out, err := g.git(nil, nil, "rev-parse", "--is-bare-repository", "--absolute-git-dir"); err == nil {
+		lines := strings.Fields(string(out))
+		if len(lines) == 2 && lines[0] == "true" && lines[1] == abs {
+			g.bare = true
+			return g, nil
+		}
+		if len(lines) == 2 && lines[0] == "false" && lines[1] == filepath.Join(abs, ".git") {
+			return g, nil
+		}
+	}
+	if _, err := g.git(nil, nil, "init", "--quiet"); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// git runs a git command in the repository with extra environment variables and stdin
+func (g *GitStore) git(env []string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", g.Dir}, args...)...)
+	cmd.Env = append(append(os.Environ(), "GIT_TERMINAL_PROMPT=0"), env...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// head returns the commit HEAD points to, or "" in a repository without commits
+func (g *GitStore) head() (string, error) {
+	out, err := g.git(nil, nil, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	if err != nil {
+		// --quiet exits with 1 and no message when HEAD has no commit yet
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && exit.ExitCode() == 1 {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// cat returns the contents of each object named like "HEAD:path", nil for those that do not exist
+func (g *GitStore) cat(objects []string) ([][]byte, error) {
+	if len(objects) == 0 {
+		return nil, nil
+	}
+	out, err := g.git(nil, []byte(strings.Join(objects, "\n")+"\n"), "cat-file", "--batch")
+	if err != nil {
+		return nil, err
+	}
+	blobs := make([][]byte, len(objects))
+	r := bufio.NewReader(bytes.NewReader(out))
+	for i := range objects {
+		header, err := r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: %v", err)
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue // "<object> missing"
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("git cat-file: bad header %q", header)
+		}
+		blobs[i] = make([]byte, size+1) // with the newline after the contents
+		if _, err := io.ReadFull(r, blobs[i]); err != nil {
+			return nil, fmt.Errorf("git cat-file: %v", err)
+		}
+		blobs[i] = blobs[i][:size]
+	}
+	return blobs, nil
+}
+
+// catHead returns the contents of a file at HEAD, or an error wrapping fs.ErrNotExist
+func (g *GitStore) catHead(file string) ([]byte, error) {
+	blobs, err := g.cat([]string{"HEAD:" + file})
+	if err != nil {
+		return nil, err
+	}
+	if blobs[0] == nil {
+		return nil, fmt.Errorf("%s: %w", file, fs.ErrNotExist)
+	}
+	return blobs[0], nil
+}
+
+// list returns the names of the files at HEAD in dir, or at the top if dir is ""
+func (g *GitStore) list(dir string) ([]string, error) {
+	head, err := g.head()
+	if err != nil || head == "" {
+		return nil, err
+	}
+	args := []string{"ls-tree", "--name-only", "-z", head}
+	if dir != "" {
+		args = append(args, "--", dir+"/")
+	}
+	out, err := g.git(nil, nil, args...)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			names = append(names, path.Base(name))
+		}
+	}
+	return names, nil
+}
+
+// gitName makes an author usable as a git identity: git rejects names with angle brackets
+// or newlines, and names left empty once it strips spaces and punctuation from the ends
+func gitName(author string) string {
+	author = strings.Map(func(r rune) rune {
+		if r == '<' || r == '>' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, author)
+	author = strings.TrimSpace(author)
+	if strings.Trim(author, ".,:;\"'\\") == "" {
+		return "unknown"
+	}
+	return author
+}
+
+// gitChange is the content of one commit: files to write and files to remove
+type gitChange struct {
+	write  map[string][]byte
+	remove []string
+}
+
+// commit records a change on top of HEAD
+func (g *GitStore) commit(c gitChange, author string, when time.Time, message string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	parent, err := g.head()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp("", "wiki-index")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+	index := []string{"GIT_INDEX_FILE=" + tmp + "/index"}
+	if parent != "" {
+		if _, err := g.git(index, nil, "read-tree", parent); err != nil {
+			return err
+		}
+	}
+	// --index-info takes "<mode> <object>\t<path>" lines and removes the paths given mode 0; unlike
+	// --force-remove it works without a working tree
+	var info strings.Builder
+	for file, data := range c.write {
+		out, err := g.git(nil, data, "hash-object", "-w", "--stdin")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&info, "100644 %s\t%s\n", strings.TrimSpace(string(out)), file)
+	}
+	for _, file := range c.remove {
+		fmt.Fprintf(&info, "0 %s\t%s\n", strings.Repeat("0", 40), file)
+	}
+	if _, err := g.git(index, []byte(info.String()), "update-index", "--index-info"); err != nil {
+		return err
+	}
+	out, err := g.git(index, nil, "write-tree")
+	if err != nil {
+		return err
+	}
+	tree := strings.TrimSpace(string(out))
+
+	author = gitName(author)
+	if when.IsZero() {
+		when = time.Now()
+	}
+	date := strconv.FormatInt(when.Unix(), 10) + " +0000"
+	ident := []string{
+		"GIT_AUTHOR_NAME=" + author, "GIT_AUTHOR_EMAIL=", "GIT_AUTHOR_DATE=" + date,
+		"GIT_COMMITTER_NAME=" + author, "GIT_COMMITTER_EMAIL=", "GIT_COMMITTER_DATE=" + date,
+	}
+	args := []string{"commit-tree", tree}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	out, err = g.git(ident, []byte(message), args...)
+	if err != nil {
+		return err
+	}
+	commit := strings.TrimSpace(string(out))
+	// Only moves HEAD if nobody else did in the meantime
+	if _, err := g.git(nil, nil, "update-ref", "HEAD", commit, parent); err != nil {
+		return err
+	}
+
+	if g.bare {
+		return nil
+	}
+	update := []string{"read-tree", "-m", "-u", tree}
+	if parent != "" {
+		update = []string{"read-tree", "-m", "-u", parent, tree}
+	}
+	if _, err := g.git(nil, nil, update...); err != nil {
+		return fmt.Errorf("committed %s but could not update the working tree: %v", commit[:12], err)
+	}
+	return nil
+}
+
+func gitPageFile(title string) string {
+	return storageKey(title) + ".txt"
+}
+
+// gitRevisionFile holds the number of the current revision. Writing it with every save means
+// saving unchanged text still makes a commit that touches the page, which git log would skip otherwise.
+func gitRevisionFile(title string) string {
+	return storageKey(title) + ".rev"
+}
+
+func gitAttachmentDir(title string) string {
+	return storageKey(title) + ".files"
+}
+
+func gitAttachmentFile(title, name string) string {
+	return gitAttachmentDir(title) + "/" + storageKey(name)
+}
+
+func (g *GitStore) Load(title string) (*Page, error) {
+	blobs, err := g.cat([]string{"HEAD:" + gitPageFile(title), "HEAD:" + gitRevisionFile(title)})
+	if err != nil {
+		return nil, err
+	}
+	if blobs[0] == nil {
+		return nil, fmt.Errorf("%s: %w", gitPageFile(title), fs.ErrNotExist)
+	}
+	p := &Page{Title: title, Body: blobs[0]}
+	if blobs[1] != nil {
+		if p.Revision, err = strconv.Atoi(strings.TrimSpace(string(blobs[1]))); err == nil {
+			return p, nil
+		}
+	}
+	// Pages saved before the revision number was kept count their log instead
+	if revs, err := g.History(title); err == nil {
+		p.Revision = len(revs)
+	}
+	return p, nil
+}
+
+func (g *GitStore) Exists(title string) (bool, error) {
+	out, err := g.git(nil, []byte("HEAD:"+gitPageFile(title)+"\n"), "cat-file", "--batch-check")
+	if err != nil {
+		return false, err
+	}
+	return !bytes.HasSuffix(bytes.TrimSpace(out), []byte(" missing")), nil
+}
+
+// History reads the log of the page file back to the commit that last deleted it
+func (g *GitStore) History(title string) ([]Revision, error) {
+	head, err := g.head()
+	if err != nil || head == "" {
+		return nil, err
+	}
+	file := gitPageFile(title)
+	out, err := g.git(nil, nil, "log", "--format=%x1e%H%x00%an%x00%at%x00%B%x00", "--name-status", "--no-renames", head, "--", file, gitRevisionFile(title))
+	if err != nil {
+		return nil, err
+	}
+	var revs []Revision
+	var objects []string
+	for _, entry := range strings.Split(string(out), "\x1e") {
+		fields := strings.SplitN(entry, "\x00", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		if slices.Contains(strings.Split(fields[4], "\n"), "D\t"+file) {
+			break
+		}
+		at, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error reading history of %s: %v", title, err)
+		}
+		revs = append(revs, Revision{Author: fields[1], Timestamp: time.Unix(at, 0), Summary: strings.TrimSpace(fields[3])})
+		objects = append(objects, fields[0]+":"+file)
+	}
+	bodies, err := g.cat(objects)
+	if err != nil {
+		return nil, err
+	}
+	// The log is newest first
+	n := len(revs)
+	history := make([]Revision, n)
+	for i, rev := range revs {
+		rev.ID = n - i
+		rev.Body = bodies[i]
+		history[n-1-i] = rev
+	}
+	return history, nil
+}
+
+// Save commits the body with the revision summary as the message, or "Edit <title>" without one
+func (g *GitStore) Save(title string, rev Revision) error {
+	message := rev.Summary
+	if message == "" {
+		message = "Edit " + title
+	}
+	change := gitChange{write: map[string][]byte{
+		gitPageFile(title):     rev.Body,
+		gitRevisionFile(title): []byte(strconv.Itoa(rev.ID) + "\n"),
+	}}
+	return g.commit(change, rev.Author, rev.Timestamp, message)
+}
+
+func (g *GitStore) Titles() ([]string, error) {
+	names, err := g.list("")
+	if err != nil {
+		return nil, err
+	}
+	var titles []string
+	for _, name := range names {
+		if key, ok := strings.CutSuffix(name, ".txt"); ok {
+			if title, ok := titleFromKey(key); ok {
+				titles = append(titles, title)
+			}
+		}
+	}
+	return titles, nil
+}
+
+func (g *GitStore) Delete(title string) error {
+	if _, err := g.catHead(gitPageFile(title)); err != nil {
+		return err
+	}
+	remove := []string{gitPageFile(title), gitRevisionFile(title)}
+	files, err := g.list(gitAttachmentDir(title))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		remove = append(remove, gitAttachmentDir(title)+"/"+f)
+	}
+	return g.commit(gitChange{remove: remove}, "wiki", time.Now(), "Delete "+title)
+}
+
+func (g *GitStore) Attachments(title string) ([]Attachment, error) {
+	names, err := g.list(gitAttachmentDir(title))
+	if err != nil {
+		return nil, err
+	}
+	var objects []string
+	for _, name := range names {
+		if strings.HasSuffix(name, ".json") {
+			objects = append(objects, "HEAD:"+gitAttachmentDir(title)+"/"+name)
+		}
+	}
+	metas, err := g.cat(objects)
+	if err != nil {
+		return nil, err
+	}
+	var list []Attachment
+	for i, meta := range metas {
+		var a Attachment
+		if err := json.Unmarshal(meta, &a); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", objects[i], err)
+		}
+		list = append(list, a)
+	}
+	sortAttachments(list)
+	return list, nil
+}
+
+func (g *GitStore) LoadAttachment(title, name string) (*Attachment, []byte, error) {
+	file := gitAttachmentFile(title, name)
+	blobs, err := g.cat([]string{"HEAD:" + file + ".json", "HEAD:" + file})
+	if err != nil {
+		return nil, nil, err
+	}
+	if blobs[0] == nil || blobs[1] == nil {
+		return nil, nil, fmt.Errorf("%s: %w", file, fs.ErrNotExist)
+	}
+	var a Attachment
+	if err := json.Unmarshal(blobs[0], &a); err != nil {
+		return nil, nil, fmt.Errorf("error reading %s: %v", file, err)
+	}
+	return &a, blobs[1], nil
+}
+
+func (g *GitStore) SaveAttachment(title string, a Attachment, data []byte) error {
+	meta, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	file := gitAttachmentFile(title, a.Name)
+	change := gitChange{write: map[string][]byte{file: data, file + ".json": meta}}
+	return g.commit(change, a.Author, a.Timestamp, "Attach "+a.Name+" to "+title)
+}
+
+func (g *GitStore) DeleteAttachment(title, name string) error {
+	file := gitAttachmentFile(title, name)
+	if _, err := g.catHead(file + ".json"); err != nil {
+		return err
+	}
+	return g.commit(gitChange{remove: []string{file, file + ".json"}}, "wiki", time.Now(), "Delete "+name+" from "+title)
+}
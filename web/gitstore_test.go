@@ -0,0 +1,135 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// requireGit skips tests of the git store where the git command is not installed
+func requireGit(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+}
+
+// gitLog returns one "author: message" line per commit of the repository, newest first
+func gitLog(t *testing.T, g *GitStore) []string {
+	t.Helper()
+	out, err := g.git(nil, nil, "log", "--format=%an: %s")
+	assert.NoError(t, err)
+	return strings.Split(strings.TrimSpace(string(out)), "\n")
+}
+
+func TestGitStore(t *testing.T) {
+	requireGit(t)
+	s, err := NewGitStore(t.TempDir())
+	assert.NoError(t, err)
+	testPageStore(t, s)
+}
+
+func TestGitStoreBare(t *testing.T) {
+	requireGit(t)
+	dir := t.TempDir()
+	assert.NoError(t, exec.Command("git", "init", "--quiet", "--bare", dir).Run())
+	s, err := NewGitStore(dir)
+	assert.NoError(t, err)
+	assert.True(t, s.bare)
+	testPageStore(t, s)
+
+	_, err = os.Stat(filepath.Join(dir, "Home.txt"))
+	assert.True(t, os.IsNotExist(err), "a bare repository has no working tree")
+}
+
+func TestGitStoreCommits(t *testing.T) {
+	requireGit(t)
+	dir := t.TempDir()
+	s, _ := NewGitStore(dir)
+	wk := New(s)
+
+	post(t, wk, "/save/Home", url.Values{"body": {"first"}, "author": {"alice"}, "summary": {"create"}})
+	post(t, wk, "/save/Home", url.Values{"body": {"second"}, "author": {"bob"}})
+	assert.Equal(t, []string{"bob: Edit Home", "alice: create"}, gitLog(t, s))
+
+	// The working tree follows the commits
+	data, err := os.ReadFile(filepath.Join(dir, "Home.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	// Reopening finds the same repository rather than a new one inside it
+	s, err = NewGitStore(dir)
+	assert.NoError(t, err)
+	revs, _ := s.History("Home")
+	assert.Equal(t, 2, len(revs))
+	assert.Equal(t, "create", revs[0].Summary)
+	assert.Equal(t, "bob", revs[1].Author)
+
+	// A page created again after being deleted starts a new history
+	assert.NoError(t, s.Delete("Home"))
+	_, err = os.Stat(filepath.Join(dir, "Home.txt"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NoError(t, s.Save("Home", Revision{ID: 1, Author: "carol", Body: []byte("again")}))
+	revs, _ = s.History("Home")
+	assert.Equal(t, 1, len(revs))
+	assert.Equal(t, "again", string(revs[0].Body))
+}
+
+func TestGitStoreMove(t *testing.T) {
+	requireGit(t)
+	s, _ := NewGitStore(t.TempDir())
+	wk := New(s)
+	post(t, wk, "/save/Old", url.Values{"body": {"text"}, "author": {"alice"}})
+
+	post(t, wk, "/move/Old", url.Values{"to": {"New Name"}})
+	p, err := s.Load("New Name")
+	assert.NoError(t, err)
+	assert.Equal(t, "text", string(p.Body))
+	titles, _ := s.Titles()
+	assert.Contains(t, titles, "New Name")
+}
+
+func TestGitStoreIgnoresParentRepository(t *testing.T) {
+	requireGit(t)
+	parent := t.TempDir()
+	assert.NoError(t, exec.Command("git", "init", "--quiet", parent).Run())
+	s, err := NewGitStore(filepath.Join(parent, "wiki"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Save("Home", Revision{Body: []byte("x")}))
+	_, err = os.Stat(filepath.Join(parent, "wiki", ".git"))
+	assert.NoError(t, err)
+}
+
+func TestGitStoreNullEdit(t *testing.T) {
+	requireGit(t)
+	s, _ := NewGitStore(t.TempDir())
+	wk := New(s)
+	post(t, wk, "/save/Home", url.Values{"body": {"same"}})
+	post(t, wk, "/save/Home", url.Values{"body": {"same"}, "base": {"1"}, "summary": {"touch"}})
+
+	// The revision reported to the editor exists, so editing on from it is not a conflict
+	p, _ := wk.loadPage("Home")
+	assert.Equal(t, 2, p.Revision)
+	assert.NoError(t, wk.save(&Page{Title: "Home", Body: []byte("new")}, 2, "ann", ""))
+	revs, _ := s.History("Home")
+	assert.Equal(t, 3, len(revs))
+	assert.Equal(t, "touch", revs[1].Summary)
+}
+
+func TestGitStoreAuthorNames(t *testing.T) {
+	requireGit(t)
+	s, _ := NewGitStore(t.TempDir())
+	wk := New(s)
+	rec := post(t, wk, "/save/Home", url.Values{"body": {"x"}, "author": {"<>"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.NoError(t, s.Save("Home", Revision{Body: []byte("y"), Author: "a\n<b>"}))
+	revs, _ := s.History("Home")
+	assert.Equal(t, "unknown", revs[0].Author)
+	assert.Equal(t, "ab", revs[1].Author)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"net/http"
+	"slices"
+	"sync"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// pageLinks returns the distinct titles a page body links to with [[WikiLinks]]
+func pageLinks(body []byte) []string {
+	var targets []string
+	doc := markdown.Parser().Parse(text.NewReader(body))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*wikiLink); ok && entering && !slices.Contains(targets, link.Target) {
+			targets = append(targets, link.Target)
+		}
+		return ast.WalkContinue, nil
+	})
+	return targets
+}
+
+// indexLinks records the links and categories of a page body in their graphs; a nil body
+// drops a deleted page
+func (wk *Wiki) indexLinks(title string, body []byte) {
+	wk.linkIndex().update(title, pageLinks(body))
+	wk.categoryIndex().update(title, pageCategories(body))
+}
+
+// linkGraph tracks which pages link to which, in both directions
+type linkGraph struct {
+	sync.RWMutex
+	outgoing map[string][]string
+	incoming map[string]map[string]bool
+}
+
+func newLinkGraph() *linkGraph {
+	return &linkGraph{
+		outgoing: make(map[string][]string),
+		incoming: make(map[string]map[string]bool),
+	}
+}
+
+// update replaces the outgoing links of title with targets
+func (g *linkGraph) update(title string, targets []string) {
+	g.Lock()
+	defer g.Unlock()
+	for _, t := range g.outgoing[title] {
+		delete(g.incoming[t], title)
+	}
+	g.outgoing[title] = targets
+	for _, t := range targets {
+		if g.incoming[t] == nil {
+			g.incoming[t] = make(map[string]bool)
+		}
+		g.incoming[t][title] = true
+	}
+}
+
+// backlinks returns the pages linking to title in alphabetical order
+func (g *linkGraph) backlinks(title string) []string {
+	g.RLock()
+	defer g.RUnlock()
+	var sources []string
+	for s := range g.incoming[title] {
+		sources = append(sources, s)
+	}
+	slices.Sort(sources)
+	return sources
+}
+
+// links returns the titles title links to
+func (g *linkGraph) links(title string) []string {
+	g.RLock()
+	defer g.RUnlock()
+	return slices.Clone(g.outgoing[title])
+}
+
+// targets returns every title at least one page links to
+func (g *linkGraph) targets() []string {
+	g.RLock()
+	defer g.RUnlock()
+	var targets []string
+	for t, sources := range g.incoming {
+		if len(sources) > 0 {
+			targets = append(targets, t)
+		}
+	}
+	slices.Sort(targets)
+	return targets
+}
+
+// linkIndex returns the link graph, building it from the stored pages on first use
+func (wk *Wiki) linkIndex() *linkGraph {
+	wk.linksOnce.Do(func() {
+		wk.links = newLinkGraph()
+		titles, _ := wk.store.Titles()
+		for _, title := range titles {
+			if p, err := wk.loadPage(title); err == nil {
+				wk.links.update(title, pageLinks(p.Body))
+			}
+		}
+	})
+	return wk.links
+}
+
+type backlinksView struct {
+	Title     string
+	Backlinks []string
+}
+
+func (wk *Wiki) backlinksHandler(w http.ResponseWriter, r *http.Request, title string) {
+	wk.renderTemplate(w, r, "backlinks", &backlinksView{Title: title, Backlinks: wk.readable(r, wk.linkIndex().backlinks(title))})
+}
@@ -0,0 +1,49 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageLinks(t *testing.T) {
+	assert.Equal(t, []string{"A", "B"}, pageLinks([]byte("[[A]] [[B|b]] [[A]] `[[C]]`")))
+	assert.Empty(t, pageLinks([]byte("no links")))
+}
+
+func TestLinkGraph(t *testing.T) {
+	g := newLinkGraph()
+	g.update("A", []string{"C"})
+	g.update("B", []string{"C", "A"})
+	assert.Equal(t, []string{"A", "B"}, g.backlinks("C"))
+	assert.Equal(t, []string{"B"}, g.backlinks("A"))
+
+	g.update("B", []string{"A"})
+	assert.Equal(t, []string{"A"}, g.backlinks("C"))
+}
+
+func TestBacklinks(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Target", url.Values{"body": {"target page"}})
+	post(t, h, "/save/Source", url.Values{"body": {"see [[Target]]"}})
+
+	rec := get(t, h, "/backlinks/Target")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<a href="/view/Source">Source</a>`)
+
+	rec = get(t, h, "/view/Target")
+	assert.Contains(t, rec.Body.String(), "What links here")
+	assert.Contains(t, rec.Body.String(), `<a href="/view/Source">Source</a>`)
+
+	post(t, h, "/save/Source", url.Values{"body": {"no more links"}})
+	rec = get(t, h, "/backlinks/Target")
+	assert.Contains(t, rec.Body.String(), "No pages link to Target")
+}
+
+func TestBacklinksBuiltFromExistingPages(t *testing.T) {
+	wk := newTestWiki(t)
+	assert.NoError(t, wk.store.Save("Source", Revision{ID: 1, Body: []byte("[[Target]]")}))
+	assert.Equal(t, []string{"Source"}, wk.linkIndex().backlinks("Target"))
+}
@@ -0,0 +1,55 @@
+package web
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdown renders page bodies as CommonMark with the GitHub extensions (tables, strikethrough,
+// autolinks, task lists) and [[WikiLinks]]. Unsafe mode stays off so raw HTML in a body is omitted
+// and links with dangerous schemes such as javascript: are dropped, which keeps the output safe to embed.
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, wikiLinks{}),
+)
+
+// renderMarkdown converts the body of page title to sanitized HTML; exists reports whether a linked page has been written.
+// Front matter is metadata and is left out. Headings get id attributes to link to and are returned in order.
+func renderMarkdown(title string, body []byte, exists func(title string) bool) (template.HTML, []heading, error) {
+	_, body = splitFrontMatter(body)
+	doc := markdown.Parser().Parse(text.NewReader(body))
+	var headings []heading
+	anchors := newAnchorSlugs()
+	err := ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			h := heading{Level: n.Level, Text: headingText(n, body)}
+			h.ID = anchors.anchor(h.Text)
+			n.SetAttributeString("id", []byte(h.ID))
+			headings = append(headings, h)
+		case *wikiLink:
+			n.Missing = !exists(n.Target)
+		case *wikiFile:
+			if n.Page == "" {
+				n.Page = title
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Renderer().Render(&buf, body, doc); err != nil {
+		return "", nil, err
+	}
+	return template.HTML(buf.String()), headings, nil
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func noPages(string) bool { return false }
+
+func TestRenderMarkdown(t *testing.T) {
+	body := "# Title\n\n- one\n- two\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n```go\nfmt.Println()\n```\n\nsee https://go.dev\n"
+	html, _, err := renderMarkdown("Test", []byte(body), noPages)
+	assert.NoError(t, err)
+	s := string(html)
+	assert.Contains(t, s, `<h1 id="title">Title</h1>`)
+	assert.Contains(t, s, "<li>one</li>")
+	assert.Contains(t, s, "<table>")
+	assert.Contains(t, s, `<code class="language-go">`)
+	assert.Contains(t, s, `<a href="https://go.dev">https://go.dev</a>`)
+}
+
+func TestRenderMarkdownSanitizes(t *testing.T) {
+	html, _, err := renderMarkdown("Test", []byte("<script>alert(1)</script>\n\n[x](javascript:alert(1))\n"), noPages)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(html), "<script>")
+	assert.NotContains(t, string(html), "javascript:")
+}
+
+func TestViewRendersMarkdown(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"## Heading\n\n*emphasis*"}})
+
+	rec := get(t, h, "/view/Home")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<h2 id="heading">Heading</h2>`)
+	assert.Contains(t, rec.Body.String(), "<em>emphasis</em>")
+
+	rec = get(t, h, "/edit/Home")
+	assert.Contains(t, rec.Body.String(), "## Heading")
+}
+
+func TestWikiLinks(t *testing.T) {
+	exists := func(title string) bool { return title == "Home" }
+	html, _, err := renderMarkdown("Test", []byte("See [[Home]], [[Home|the start]] and [[Missing]]. `[[Code]]` [[not/../valid]]"), exists)
+	assert.NoError(t, err)
+	s := string(html)
+	assert.Contains(t, s, `<a class="wikilink" href="/view/Home">Home</a>`)
+	assert.Contains(t, s, `<a class="wikilink" href="/view/Home">the start</a>`)
+	assert.Contains(t, s, `<a class="wikilink missing" href="/edit/Missing"`)
+	assert.Contains(t, s, "<code>[[Code]]</code>")
+	assert.Contains(t, s, "[[not/../valid]]")
+}
+
+func TestWikiLinkLabelEscaped(t *testing.T) {
+	html, _, err := renderMarkdown("Test", []byte("[[Home|<b>x</b>]]"), noPages)
+	assert.NoError(t, err)
+	assert.Contains(t, string(html), "&lt;b&gt;x&lt;/b&gt;")
+}
+
+func TestViewMarksMissingLinks(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"[[Home]] [[Other]]"}})
+
+	rec := get(t, h, "/view/Home")
+	assert.Contains(t, rec.Body.String(), `href="/view/Home"`)
+	assert.Contains(t, rec.Body.String(), `href="/edit/Other"`)
+}
@@ -0,0 +1,297 @@
+package web
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+
+	elastic "go-wiki/elasticsearch"
+)
+
+// errPageExists means a page cannot be moved because the new title is taken
+var errPageExists = errors.New("a page with that title already exists")
+
+// redirectPattern matches the stub left behind by a move, e.g. "#REDIRECT [[New Title]]"
+var redirectPattern = regexp.MustCompile(`(?i)^\s*#REDIRECT\s*\[\[([^\[\]|]+)\]\]`)
+
+// redirectTarget returns the page a redirect stub points to
+func redirectTarget(body []byte) (string, bool) {
+	m := redirectPattern.FindSubmatch(body)
+	if m == nil {
+		return "", false
+	}
+	return normalizeTitle(string(m[1]))
+}
+
+func redirectBody(to string) []byte {
+	return []byte("#REDIRECT [[" + to + "]]\n")
+}
+
+// rewriteLinks points every [[from]] link in body at to, keeping labels. Links inside code
+// are left alone because they are not links.
+func rewriteLinks(body []byte, from, to string) []byte {
+	var links []*wikiLink
+	doc := markdown.Parser().Parse(text.NewReader(body))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*wikiLink); ok && entering && link.Target == from {
+			links = append(links, link)
+		}
+		return ast.WalkContinue, nil
+	})
+	if len(links) == 0 {
+		return body
+	}
+	var out bytes.Buffer
+	last := 0
+	for _, link := range links {
+		out.Write(body[last:link.Source.Start])
+		if link.Labeled {
+			out.WriteString("[[" + to + "|" + link.Label + "]]")
+		} else {
+			out.WriteString("[[" + to + "]]")
+		}
+		last = link.Source.Stop
+	}
+	out.Write(body[last:])
+	return out.Bytes()
+}
+
+// moveOptions controls what happens around a move besides renaming the page
+type moveOptions struct {
+	Redirect     bool // leave a redirect stub at the old title
+	RewriteLinks bool // update links in pages linking to the old title
+}
+
+// moveResult lists the pages linking to a moved page whose links were or were not updated
+type moveResult struct {
+	Rewritten []string
+	Skipped   []string // pages the mover may not edit, still linking to the old title
+}
+
+// move renames a page for the requester, carrying over its history and attachments. base is the revision
+// of the page the move was requested from; a page changed since then makes move return errEditConflict.
+// Links are only rewritten in pages the requester may edit.
+func (wk *Wiki) move(r *http.Request, from, to string, base int, opts moveOptions) (*moveResult, error) {
+	by := author(r)
+	wk.saveMu.Lock()
+	defer wk.saveMu.Unlock()
+
+	if from == to {
+		return nil, fmt.Errorf("%s already has that title", from)
+	}
+	history, err := wk.store.History(from)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, fmt.Errorf("page %s: %w", from, fs.ErrNotExist)
+	}
+	if err := checkBase(history, base); err != nil {
+		return nil, err
+	}
+	if existing, _ := wk.store.History(to); len(existing) > 0 {
+		return nil, errPageExists
+	}
+
+	backlinks := wk.linkIndex().backlinks(from)
+	if err := wk.copyPage(from, to, history, by, opts); err != nil {
+		// Without the partial copy the move can simply be tried again
+		if undoErr := wk.removeCopy(to); undoErr != nil {
+			return nil, fmt.Errorf("%w; the partial copy at %s could not be removed: %v", err, to, undoErr)
+		}
+		return nil, err
+	}
+	wk.indexLinks(from, nil)
+	wk.loadSearchIndex()
+	if err := elastic.DeleteDocument(wk.searchIndex, from); err != nil {
+		return nil, err
+	}
+	if opts.Redirect {
+		stub := &Page{Title: from, Body: redirectBody(to)}
+		if err := wk.saveLocked(stub, 0, by, "Moved to "+to); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &moveResult{}
+	if opts.RewriteLinks {
+		for _, title := range backlinks {
+			if title == from {
+				continue
+			}
+			if !wk.allowed(r, title, editAccess) {
+				res.Skipped = append(res.Skipped, title)
+				continue
+			}
+			p, err := wk.store.Load(title)
+			if err != nil {
+				continue
+			}
+			body := rewriteLinks(p.Body, from, to)
+			if bytes.Equal(body, p.Body) {
+				continue
+			}
+			p.Body = body
+			if err := wk.saveLocked(p, p.Revision, by, "Updated links to "+from+", now "+to); err != nil {
+				return res, err
+			}
+			res.Rewritten = append(res.Rewritten, title)
+		}
+	}
+	wk.publishMoved(from, to, by)
+	return res, nil
+}
+
+// copyPage gives to the history, current body and attachments of from, then deletes from.
+// On an error from is left in place unless deleting it was what failed halfway.
+func (wk *Wiki) copyPage(from, to string, history []Revision, by string, opts moveOptions) error {
+	for _, rev := range history {
+		if err := wk.store.Save(to, rev); err != nil {
+			return err
+		}
+	}
+	// A revision on the new title records the move in its history, taking any links of the
+	// page to itself along
+	current := history[len(history)-1].Body
+	if opts.RewriteLinks {
+		current = rewriteLinks(current, from, to)
+	}
+	moved := &Page{Title: to, Body: current}
+	if err := wk.saveLocked(moved, len(history), by, "Moved from "+from); err != nil {
+		return err
+	}
+
+	files, err := wk.store.Attachments(from)
+	if err != nil {
+		return err
+	}
+	for _, a := range files {
+		a, data, err := wk.store.LoadAttachment(from, a.Name)
+		if err != nil {
+			return err
+		}
+		if err := wk.store.SaveAttachment(to, *a, data); err != nil {
+			return err
+		}
+	}
+
+	if err := wk.store.Delete(from); err != nil {
+		// Once some of from is gone the copy is all that is left of the page, so it stays
+		if exists, _ := wk.store.Exists(from); !exists {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// removeCopy undoes a copyPage that failed
+func (wk *Wiki) removeCopy(to string) error {
+	if exists, err := wk.store.Exists(to); err != nil || !exists {
+		return err
+	}
+	if err := wk.store.Delete(to); err != nil {
+		return err
+	}
+	wk.indexLinks(to, nil)
+	wk.publishDeleted(to)
+	wk.loadSearchIndex()
+	return elastic.DeleteDocument(wk.searchIndex, to)
+}
+
+type moveView struct {
+	Title    string
+	Revision int
+	To       string
+	Redirect bool
+	Rewrite  bool
+	Error    string
+	Links    []string // pages linking to Title
+	Skipped  []string // after a move, linking pages the mover could not update
+}
+
+func (wk *Wiki) moveFormHandler(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := wk.loadPage(title)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	wk.renderTemplate(w, r, "move", &moveView{
+		Title:    title,
+		Revision: p.Revision,
+		To:       title,
+		Redirect: true,
+		Rewrite:  true,
+		Links:    wk.readable(r, wk.linkIndex().backlinks(title)),
+	})
+}
+
+func (wk *Wiki) moveHandler(w http.ResponseWriter, r *http.Request, title string) {
+	v := &moveView{
+		Title:    title,
+		Revision: formBase(r),
+		To:       r.FormValue("to"),
+		Redirect: r.FormValue("redirect") != "",
+		Rewrite:  r.FormValue("rewrite") != "",
+		Links:    wk.readable(r, wk.linkIndex().backlinks(title)),
+	}
+	to, ok := normalizeTitle(v.To)
+	if !ok {
+		v.Error = fmt.Sprintf("The new title is not valid. Titles may not contain any of %s or _ and are at most %d bytes long.", titleSpecials, maxTitleLen)
+		wk.renderTemplateStatus(w, r, http.StatusUnprocessableEntity, "move", v)
+		return
+	}
+	if to == title {
+		v.Error = "The new title is the same as the old one."
+		wk.renderTemplateStatus(w, r, http.StatusUnprocessableEntity, "move", v)
+		return
+	}
+	if !wk.allowed(r, to, editAccess) {
+		wk.deny(w, r)
+		return
+	}
+	res, err := wk.move(r, title, to, v.Revision, moveOptions{Redirect: v.Redirect, RewriteLinks: v.Rewrite})
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, errEditConflict):
+		v.Error = "The page was changed since you loaded this form. Check the changes and try again."
+		v.Revision = wk.currentRevision(title)
+		wk.renderTemplateStatus(w, r, http.StatusConflict, "move", v)
+	case errors.Is(err, errPageExists):
+		v.Error = "A page called " + to + " already exists."
+		wk.renderTemplateStatus(w, r, http.StatusConflict, "move", v)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		// Say which links are left pointing at the old title instead of quietly leaving them
+		if v.Skipped = wk.readable(r, res.Skipped); len(v.Skipped) > 0 {
+			v.To = to
+			wk.renderTemplate(w, r, "move", v)
+			return
+		}
+		http.Redirect(w, r, "/view/"+slug(to), http.StatusFound)
+	}
+}
+
+// followRedirect sends visitors of a redirect stub on to its target, once, so a stub
+// pointing at another stub cannot loop. ?redirect=no shows the stub itself.
+func followRedirect(w http.ResponseWriter, r *http.Request, p *Page) bool {
+	q := r.URL.Query()
+	if q.Get("redirect") == "no" || q.Has("from") || q.Has("rev") {
+		return false
+	}
+	target, ok := redirectTarget(p.Body)
+	if !ok || target == p.Title {
+		return false
+	}
+	http.Redirect(w, r, "/view/"+slug(target)+"?from="+url.QueryEscape(p.Title), http.StatusFound)
+	return true
+}
@@ -0,0 +1,150 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"go-wiki/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewriteLinks(t *testing.T) {
+	body := "See [[Old]], [[Old|the old page]], [[Old_]] and [[Other]].\n\n`[[Old]]`\n"
+	got := string(rewriteLinks([]byte(body), "Old", "New Name"))
+	assert.Equal(t, "See [[New Name]], [[New Name|the old page]], [[New Name]] and [[Other]].\n\n`[[Old]]`\n", got)
+
+	unchanged := []byte("no links here")
+	assert.Equal(t, unchanged, rewriteLinks(unchanged, "Old", "New"))
+}
+
+func TestRedirectTarget(t *testing.T) {
+	target, ok := redirectTarget([]byte("#REDIRECT [[Release_Notes/2026]]\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "Release Notes/2026", target)
+	_, ok = redirectTarget([]byte("Text first\n#REDIRECT [[Home]]"))
+	assert.False(t, ok)
+}
+
+func TestMovePage(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Old", url.Values{"body": {"v1"}, "author": {"alice"}})
+	post(t, h, "/save/Old", url.Values{"body": {"v2 links to [[Old]]"}, "author": {"bob"}})
+	post(t, h, "/save/Linker", url.Values{"body": {"see [[Old|here]]"}})
+
+	rec := get(t, h, "/move/Old")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<input type="hidden" name="base" value="2">`)
+
+	rec = post(t, h, "/move/Old", url.Values{"to": {"New Home"}, "base": {"2"}, "redirect": {"1"}, "rewrite": {"1"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/view/New_Home", rec.Header().Get("Location"))
+
+	// History came along, plus a revision recording the move
+	revs, _ := h.store.History("New Home")
+	assert.Equal(t, 3, len(revs))
+	assert.Equal(t, "alice", revs[0].Author)
+	assert.Equal(t, "Moved from Old", revs[2].Summary)
+	p, _ := h.loadPage("New Home")
+	assert.Equal(t, "v2 links to [[New Home]]", string(p.Body))
+
+	p, _ = h.loadPage("Linker")
+	assert.Equal(t, "see [[New Home|here]]", string(p.Body))
+	assert.Equal(t, []string{"Linker", "New Home", "Old"}, h.linkIndex().backlinks("New Home"))
+	assert.Empty(t, h.linkIndex().backlinks("Old"))
+
+	// The old URL redirects, and the stub itself can still be looked at
+	rec = get(t, h, "/view/Old")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/view/New_Home?from=Old", rec.Header().Get("Location"))
+	assert.Contains(t, get(t, h, "/view/New_Home?from=Old").Body.String(), `Redirected from <a href="/view/Old?redirect=no">Old</a>`)
+	assert.Equal(t, http.StatusOK, get(t, h, "/view/Old?redirect=no").Code)
+}
+
+func TestMoveWithoutRedirect(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Old", url.Values{"body": {"text"}})
+	post(t, h, "/save/Linker", url.Values{"body": {"see [[Old]]"}})
+
+	assert.Equal(t, http.StatusFound, post(t, h, "/move/Old", url.Values{"to": {"New"}, "base": {"1"}}).Code)
+	assert.False(t, h.pageExists("Old"))
+	p, _ := h.loadPage("Linker")
+	assert.Equal(t, "see [[Old]]", string(p.Body))
+}
+
+func TestMoveErrors(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Old", url.Values{"body": {"text"}})
+	post(t, h, "/save/Taken", url.Values{"body": {"text"}})
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/move/Missing").Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, post(t, h, "/move/Old", url.Values{"to": {"a#b"}, "base": {"1"}}).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, post(t, h, "/move/Old", url.Values{"to": {"Old"}, "base": {"1"}}).Code)
+	assert.Equal(t, http.StatusConflict, post(t, h, "/move/Old", url.Values{"to": {"Taken"}, "base": {"1"}}).Code)
+	assert.Equal(t, http.StatusConflict, post(t, h, "/move/Old", url.Values{"to": {"New"}, "base": {"0"}}).Code)
+	assert.True(t, h.pageExists("Old"))
+	assert.False(t, h.pageExists("New"))
+}
+
+// failingAttachments is a store whose disk fills up when attachments are saved
+type failingAttachments struct {
+	PageStore
+}
+
+func (failingAttachments) SaveAttachment(string, Attachment, []byte) error {
+	return errors.New("no space left on device")
+}
+
+func TestFailedMoveLeavesNoCopy(t *testing.T) {
+	s := NewStorageStore(storage.NewMemory[[]Revision]())
+	assert.NoError(t, s.Save("Old", Revision{Body: []byte("links to [[Other]]")}))
+	assert.NoError(t, s.SaveAttachment("Old", Attachment{Name: "a.txt"}, []byte("x")))
+	h := New(failingAttachments{s})
+
+	rec := post(t, h, "/move/Old", url.Values{"to": {"New"}, "base": {"1"}})
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.True(t, h.pageExists("Old"))
+	assert.False(t, h.pageExists("New"))
+	assert.Equal(t, []string{"Old"}, h.linkIndex().backlinks("Other"))
+
+	// Nothing is in the way of trying again
+	h.store = s
+	assert.Equal(t, http.StatusFound, post(t, h, "/move/Old", url.Values{"to": {"New"}, "base": {"1"}}).Code)
+	assert.True(t, h.pageExists("New"))
+}
+
+func TestMoveNeedsEditAccessToBothTitles(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin := loginAs(t, wk, "admin")
+	as(t, wk, admin, http.MethodPost, "/save/Notes", url.Values{"body": {"x"}})
+	editor := loginAs(t, wk, "editor")
+
+	rec := as(t, wk, editor, http.MethodPost, "/move/Notes", url.Values{"to": {"RunbookNotes"}, "base": {"1"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.True(t, wk.pageExists("Notes"))
+}
+
+func TestMoveOnlyRewritesEditablePages(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin, editor := loginAs(t, wk, "admin"), loginAs(t, wk, "editor")
+	as(t, wk, admin, http.MethodPost, "/save/Old", url.Values{"body": {"x"}})
+	as(t, wk, admin, http.MethodPost, "/save/Linker", url.Values{"body": {"see [[Old]]"}})
+	as(t, wk, admin, http.MethodPost, "/save/RunbookDB", url.Values{"body": {"see [[Old]]"}})
+	as(t, wk, admin, http.MethodPost, "/save/Secret", url.Values{"body": {"see [[Old]]"}})
+
+	rec := as(t, wk, editor, http.MethodPost, "/move/Old", url.Values{"to": {"New"}, "base": {"1"}, "rewrite": {"1"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `was moved to <a href="/view/New">New</a>`)
+	assert.Contains(t, body, `<li><a href="/view/RunbookDB">RunbookDB</a></li>`)
+	assert.NotContains(t, body, "Secret", "pages the mover cannot read are not named")
+
+	for title, want := range map[string]string{"Linker": "see [[New]]", "RunbookDB": "see [[Old]]", "Secret": "see [[Old]]"} {
+		p, _ := wk.loadPage(title)
+		assert.Equal(t, want, string(p.Body), title)
+	}
+	revs, _ := wk.store.History("RunbookDB")
+	assert.Equal(t, 1, len(revs))
+}
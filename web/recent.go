@@ -0,0 +1,249 @@
+package web
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRecentLimit = 50
+	maxRecentLimit     = 500
+)
+
+// change is one revision in the recent changes list
+type change struct {
+	Title     string
+	ID        int
+	Author    string
+	Timestamp time.Time
+	Summary   string
+	Size      int // length of the body in bytes
+	Delta     int // Size minus the size of the previous revision
+}
+
+// DeltaString formats the size change as +N or -N
+func (c change) DeltaString() string {
+	if c.Delta > 0 {
+		return "+" + strconv.Itoa(c.Delta)
+	}
+	return strconv.Itoa(c.Delta)
+}
+
+// URL links the change from the recent changes page
+func (c change) URL() string {
+	return changeURL("", c)
+}
+
+// recentChanges returns the latest revisions of the pages the requester may read, newest first.
+// It reads every history, which is fine for a wiki of a few thousand pages.
+func (wk *Wiki) recentChanges(r *http.Request, limit int) ([]change, error) {
+	titles, err := wk.store.Titles()
+	if err != nil {
+		return nil, err
+	}
+	var changes []change
+	for _, title := range wk.readable(r, titles) {
+		revs, err := wk.store.History(title)
+		if err != nil {
+			return nil, err
+		}
+		prev := 0
+		for _, rev := range revs {
+			changes = append(changes, change{
+				Title:     title,
+				ID:        rev.ID,
+				Author:    rev.Author,
+				Timestamp: rev.Timestamp,
+				Summary:   rev.Summary,
+				Size:      len(rev.Body),
+				Delta:     len(rev.Body) - prev,
+			})
+			prev = len(rev.Body)
+		}
+	}
+	slices.SortFunc(changes, func(a, b change) int {
+		if c := b.Timestamp.Compare(a.Timestamp); c != 0 {
+			return c
+		}
+		return b.ID - a.ID
+	})
+	if len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+// recentLimit reads ?limit=, falling back to the default for missing or invalid values
+func recentLimit(r *http.Request) int {
+	n, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || n < 1 {
+		return defaultRecentLimit
+	}
+	return min(n, maxRecentLimit)
+}
+
+type recentView struct {
+	Changes []change
+}
+
+func (wk *Wiki) recentHandler(w http.ResponseWriter, r *http.Request) {
+	changes, err := wk.recentChanges(r, recentLimit(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	wk.renderTemplate(w, r, "recent", &recentView{Changes: changes})
+}
+
+// baseURL is the absolute URL of the wiki as the client reached it, for links in feeds
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// changeURL links a change to its diff, or to the page for its first revision
+func changeURL(base string, c change) string {
+	if c.ID == 1 {
+		return base + "/view/" + slug(c.Title) + "?rev=1"
+	}
+	return base + "/diff/" + slug(c.Title) + "?" + url.Values{"from": {strconv.Itoa(c.ID - 1)}, "to": {strconv.Itoa(c.ID)}}.Encode()
+}
+
+func changeTitle(c change) string {
+	return fmt.Sprintf("%s (revision %d)", c.Title, c.ID)
+}
+
+func changeDescription(c change) string {
+	s := fmt.Sprintf("%s by %s, %s bytes", c.Title, c.Author, c.DeltaString())
+	if c.Summary != "" {
+		s += ": " + c.Summary
+	}
+	return s
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Link    atomLink   `xml:"link"`
+	Summary string     `xml:"summary"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"` // for dc:creator, as RSS authors must be e-mail addresses
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Author      string  `xml:"dc:creator"`
+	Description string  `xml:"description"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+func writeXML(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(v)
+}
+
+func (wk *Wiki) atomHandler(w http.ResponseWriter, r *http.Request) {
+	changes, err := wk.recentChanges(r, recentLimit(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	base := baseURL(r)
+	feed := atomFeed{
+		Title: "Recent changes",
+		ID:    base + "/recent",
+		Links: []atomLink{{Href: base + "/recent.atom", Rel: "self"}, {Href: base + "/recent"}},
+	}
+	updated := time.Now()
+	if len(changes) > 0 {
+		updated = changes[0].Timestamp
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+	for _, c := range changes {
+		link := changeURL(base, c)
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   changeTitle(c),
+			ID:      base + "/view/" + slug(c.Title) + "?rev=" + strconv.Itoa(c.ID),
+			Updated: c.Timestamp.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: c.Author},
+			Link:    atomLink{Href: link},
+			Summary: changeDescription(c),
+		})
+	}
+	writeXML(w, "application/atom+xml; charset=utf-8", feed)
+}
+
+func (wk *Wiki) rssHandler(w http.ResponseWriter, r *http.Request) {
+	changes, err := wk.recentChanges(r, recentLimit(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	base := baseURL(r)
+	feed := rssFeed{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{Title: "Recent changes", Link: base + "/recent", Description: "Latest edits to the wiki"},
+	}
+	for _, c := range changes {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       changeTitle(c),
+			Link:        changeURL(base, c),
+			GUID:        rssGUID{Value: base + "/view/" + slug(c.Title) + "?rev=" + strconv.Itoa(c.ID)},
+			PubDate:     c.Timestamp.UTC().Format(time.RFC1123Z),
+			Author:      c.Author,
+			Description: changeDescription(c),
+		})
+	}
+	writeXML(w, "application/rss+xml; charset=utf-8", feed)
+}
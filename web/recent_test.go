@@ -0,0 +1,102 @@
+package web
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newRecentWiki returns a wiki with three edits one minute apart, oldest first
+func newRecentWiki(t *testing.T) *Wiki {
+	t.Helper()
+	wk := newTestWiki(t)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i, e := range []struct{ title, author, summary, body string }{
+		{"Home", "alice", "create", "hello"},
+		{"Release Notes", "bob", "", "notes"},
+		{"Home", "carol", "shorten", "hi"},
+	} {
+		history, _ := wk.store.History(e.title)
+		rev := Revision{ID: len(history) + 1, Author: e.author, Summary: e.summary, Timestamp: start.Add(time.Duration(i) * time.Minute), Body: []byte(e.body)}
+		assert.NoError(t, wk.store.Save(e.title, rev))
+	}
+	return wk
+}
+
+func TestRecentChanges(t *testing.T) {
+	wk := newRecentWiki(t)
+	changes, err := wk.recentChanges(httptest.NewRequest(http.MethodGet, "/recent", nil), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(changes))
+	assert.Equal(t, "carol", changes[0].Author)
+	assert.Equal(t, -3, changes[0].Delta)
+	assert.Equal(t, "-3", changes[0].DeltaString())
+	assert.Equal(t, "Release Notes", changes[1].Title)
+	assert.Equal(t, "+5", changes[1].DeltaString())
+	assert.Equal(t, "alice", changes[2].Author)
+
+	rec := get(t, wk, "/recent")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `<a href="/diff/Home?from=1&amp;to=2">diff</a>`)
+	assert.Contains(t, body, `<a href="/view/Release_Notes?rev=1">new</a>`)
+	assert.Contains(t, body, "shorten")
+
+	rec = get(t, wk, "/recent?limit=1")
+	assert.Contains(t, rec.Body.String(), "carol")
+	assert.NotContains(t, rec.Body.String(), "alice")
+}
+
+func TestRecentChangesFollowsSaves(t *testing.T) {
+	wk := newTestWiki(t)
+	post(t, wk, "/save/Home", url.Values{"body": {"text"}, "author": {"dave"}, "summary": {"first edit"}})
+	assert.Contains(t, get(t, wk, "/recent").Body.String(), "first edit")
+}
+
+func TestAtomFeed(t *testing.T) {
+	wk := newRecentWiki(t)
+	rec := get(t, wk, "/recent.atom")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/atom+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	var feed atomFeed
+	assert.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &feed))
+	assert.Equal(t, "2026-03-01T12:02:00Z", feed.Updated)
+	assert.Equal(t, 3, len(feed.Entries))
+	e := feed.Entries[0]
+	assert.Equal(t, "Home (revision 2)", e.Title)
+	assert.Equal(t, "carol", e.Author.Name)
+	assert.Equal(t, "http://example.com/diff/Home?from=1&to=2", e.Link.Href)
+	assert.Equal(t, "Home by carol, -3 bytes: shorten", e.Summary)
+}
+
+func TestRSSFeed(t *testing.T) {
+	wk := newRecentWiki(t)
+	rec := get(t, wk, "/recent.rss?limit=2")
+	assert.Equal(t, "application/rss+xml; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), `<dc:creator>carol</dc:creator>`)
+
+	var feed rssFeed
+	assert.NoError(t, xml.Unmarshal(rec.Body.Bytes(), &feed))
+	assert.Equal(t, "2.0", feed.Version)
+	assert.Equal(t, 2, len(feed.Channel.Items))
+	item := feed.Channel.Items[1]
+	assert.Equal(t, "Release Notes (revision 1)", item.Title)
+	assert.Equal(t, "http://example.com/view/Release_Notes?rev=1", item.Link)
+	assert.Equal(t, "Sun, 01 Mar 2026 12:01:00 +0000", item.PubDate)
+}
+
+func TestRecentChangesHidesUnreadablePages(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	assert.NoError(t, wk.save(&Page{Title: "Secret", Body: []byte("x")}, anyRevision, "admin", "secret edit"))
+	assert.NoError(t, wk.save(&Page{Title: "Home", Body: []byte("x")}, anyRevision, "admin", "public edit"))
+
+	body := get(t, wk, "/recent.atom").Body.String()
+	assert.Contains(t, body, "public edit")
+	assert.NotContains(t, body, "secret edit")
+}
@@ -0,0 +1,90 @@
+package web
+
+import (
+	"fmt"
+	"io/fs"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Revision is an immutable snapshot of a page body recorded on every save
+type Revision struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	Timestamp time.Time `json:"timestamp"`
+	Summary   string    `json:"summary"`
+	Body      []byte    `json:"body"`
+}
+
+func (wk *Wiki) loadRevision(title string, id int) (*Revision, error) {
+	revs, err := wk.store.History(title)
+	if err != nil {
+		return nil, err
+	}
+	if id < 1 || id > len(revs) {
+		return nil, fmt.Errorf("revision %d of %s: %w", id, title, fs.ErrNotExist)
+	}
+	return &revs[id-1], nil
+}
+
+func (wk *Wiki) historyHandler(w http.ResponseWriter, r *http.Request, title string) {
+	revs, err := wk.store.History(title)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(revs) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	// Newest first
+	history := make([]Revision, len(revs))
+	for i, rev := range revs {
+		history[len(revs)-1-i] = rev
+	}
+	wk.renderTemplate(w, r, "history", &historyView{Title: title, Revisions: history})
+}
+
+type historyView struct {
+	Title     string
+	Revisions []Revision
+}
+
+var revertPath = regexp.MustCompile("^/revert/(.+)/([0-9]+)$")
+
+// revertHandler restores an old revision by saving its body as a new revision,
+// so the revert itself can be undone from the history page. Routed through protect, so POST only.
+func (wk *Wiki) revertHandler(w http.ResponseWriter, r *http.Request) {
+	m := revertPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+	title, ok := normalizeTitle(m[1])
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if !wk.allowed(r, title, editAccess) {
+		wk.deny(w, r)
+		return
+	}
+	id, err := strconv.Atoi(m[2])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	rev, err := wk.loadRevision(title, id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	p := &Page{Title: title, Body: rev.Body}
+	if err := wk.save(p, anyRevision, author(r), fmt.Sprintf("Reverted to revision %d", id)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/view/"+slug(title), http.StatusFound)
+}
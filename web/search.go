@@ -0,0 +1,148 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
+
+	elastic "go-wiki/elasticsearch"
+)
+
+// searchIndexes numbers the elastic indexes of the wikis in this process, so wikis backed by
+// different stores never see each other's pages
+var searchIndexes atomic.Int64
+
+// newSearchIndexName returns the name of the index of a new Wiki, holding one document per page
+func newSearchIndexName() string {
+	return fmt.Sprintf("pages-%d", searchIndexes.Add(1))
+}
+
+// loadSearchIndex indexes the stored pages on first use
+func (wk *Wiki) loadSearchIndex() {
+	wk.searchOnce.Do(func() {
+		elastic.NewIndex(wk.searchIndex)
+		titles, _ := wk.store.Titles()
+		for _, title := range titles {
+			if p, err := wk.loadPage(title); err == nil {
+				elastic.IndexDocument(wk.pageDocument(p))
+			}
+		}
+	})
+}
+
+func (wk *Wiki) pageDocument(p *Page) elastic.Document {
+	return elastic.Document{
+		ID:    p.Title,
+		Index: wk.searchIndex,
+		Body:  map[string]any{"title": p.Title, "body": string(p.Body)},
+	}
+}
+
+func (wk *Wiki) indexPage(p *Page) error {
+	wk.loadSearchIndex()
+	return elastic.IndexDocument(wk.pageDocument(p))
+}
+
+// snippetPart is a run of snippet text; Match marks a query term to highlight
+type snippetPart struct {
+	Text  string
+	Match bool
+}
+
+const snippetRadius = 80
+
+// snippet returns the text around the first query term in body, split so matches can be highlighted
+func snippet(body string, tokens []string) []snippetPart {
+	words := tokenSpans(body)
+	start := 0
+	for _, w := range words {
+		if slices.Contains(tokens, strings.ToLower(body[w[0]:w[1]])) {
+			start = w[0]
+			break
+		}
+	}
+	lo, hi := max(0, start-snippetRadius), min(len(body), start+snippetRadius)
+	// Don't cut a multi-byte character in half
+	for lo > 0 && !utf8.RuneStart(body[lo]) {
+		lo--
+	}
+	for hi < len(body) && !utf8.RuneStart(body[hi]) {
+		hi++
+	}
+
+	var parts []snippetPart
+	if lo > 0 {
+		parts = append(parts, snippetPart{Text: "…"})
+	}
+	pos := lo
+	for _, w := range words {
+		if w[0] < lo || w[1] > hi || !slices.Contains(tokens, strings.ToLower(body[w[0]:w[1]])) {
+			continue
+		}
+		parts = append(parts, snippetPart{Text: body[pos:w[0]]}, snippetPart{Text: body[w[0]:w[1]], Match: true})
+		pos = w[1]
+	}
+	parts = append(parts, snippetPart{Text: body[pos:hi]})
+	if hi < len(body) {
+		parts = append(parts, snippetPart{Text: "…"})
+	}
+	return parts
+}
+
+// tokenSpans returns the byte offsets of the words elastic.Tokenize would produce
+func tokenSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		word := unicode.IsLetter(r) || unicode.IsDigit(r)
+		switch {
+		case word && start < 0:
+			start = i
+		case !word && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+type searchResult struct {
+	Title   string
+	Snippet []snippetPart
+}
+
+type searchView struct {
+	Query   string
+	Results []searchResult
+}
+
+// searchHandler serves /search?q= with results ranked by the elastic index
+func (wk *Wiki) searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := strings.TrimSpace(r.URL.Query().Get("q"))
+	v := &searchView{Query: q}
+	if q != "" {
+		wk.loadSearchIndex()
+		hits, err := elastic.SearchText(wk.searchIndex, q, "title", "body")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		tokens := elastic.Tokenize(q)
+		for _, h := range hits {
+			title, _ := h.Body["title"].(string)
+			body, _ := h.Body["body"].(string)
+			if !wk.allowed(r, title, readAccess) {
+				continue
+			}
+			v.Results = append(v.Results, searchResult{Title: title, Snippet: snippet(body, tokens)})
+		}
+	}
+	wk.renderTemplate(w, r, "search", v)
+}
@@ -0,0 +1,58 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnippet(t *testing.T) {
+	parts := snippet("Restart the Database service first", []string{"database"})
+	assert.Equal(t, []snippetPart{{"Restart the ", false}, {"Database", true}, {" service first", false}}, parts)
+
+	long := "intro " + string(make([]byte, 200)) + " needle tail"
+	parts = snippet(long, []string{"needle"})
+	assert.Equal(t, "…", parts[0].Text)
+	assert.Contains(t, parts, snippetPart{"needle", true})
+}
+
+func TestSearch(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Runbook", url.Values{"body": {"Restart the database, then check the database logs."}})
+	post(t, h, "/save/Notes", url.Values{"body": {"The database is mentioned once."}})
+	post(t, h, "/save/Other", url.Values{"body": {"Nothing relevant."}})
+
+	rec := get(t, h, "/search?q=database")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "<mark>database</mark>")
+	assert.NotContains(t, body, "/view/Other")
+	assert.Less(t, strings.Index(body, "/view/Runbook"), strings.Index(body, "/view/Notes"))
+
+	rec = get(t, h, "/search?q=zebra")
+	assert.Contains(t, rec.Body.String(), "No pages match")
+}
+
+func TestSearchIndexesExistingPages(t *testing.T) {
+	h := newTestWiki(t)
+	assert.NoError(t, h.store.Save("Home", Revision{ID: 1, Body: []byte("welcome aboard")}))
+
+	rec := get(t, h, "/search?q=aboard")
+	assert.Contains(t, rec.Body.String(), "/view/Home")
+}
+
+func TestSearchIsPerWiki(t *testing.T) {
+	a, b := newTestWiki(t), newTestWiki(t)
+	post(t, a, "/save/Alpha", url.Values{"body": {"shared word"}})
+	post(t, b, "/save/Beta", url.Values{"body": {"shared word"}})
+
+	body := get(t, a, "/search?q=shared").Body.String()
+	assert.Contains(t, body, "/view/Alpha")
+	assert.NotContains(t, body, "/view/Beta")
+	body = get(t, b, "/search?q=shared").Body.String()
+	assert.Contains(t, body, "/view/Beta")
+	assert.NotContains(t, body, "/view/Alpha")
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Config holds the settings of a wiki Server; zero values fall back to the defaults below
+type Config struct {
+	Addr            string        // listen address, default ":8080"
+	DataDir         string        // directory holding the pages, default "."
+	GitDir          string        // git repository keeping the pages as commits instead of DataDir
+	TemplateDir     string        // optional directory of *.html files overriding the built-in templates
+	AuthFile        string        // JSON file of user accounts and access rules; enables login when set
+	ReadTimeout     time.Duration // default 10s
+	WriteTimeout    time.Duration // default 30s
+	ShutdownTimeout time.Duration // how long Run waits for in-flight requests, default 15s
+	TLSCertFile     string        // serve HTTPS when both the cert and key files are set
+	TLSKeyFile      string
+
+	MaxAttachmentSize int64 // largest file that can be attached to a page in bytes, default 10 MiB
+	TOCMinHeadings    int   // headings a page needs for a table of contents, default 4; negative turns it off
+}
+
+func (c *Config) setDefaults() {
+	if c.Addr == "" {
+		c.Addr = ":8080"
+	}
+	if c.DataDir == "" {
+		c.DataDir = "."
+	}
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = 10 * time.Second
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = 30 * time.Second
+	}
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = 15 * time.Second
+	}
+}
+
+// Server runs a Wiki over HTTP(S) and shuts it down gracefully
+type Server struct {
+	Config
+	Wiki *Wiki
+	http *http.Server
+}
+
+// NewServer validates cfg and prepares a Server storing pages in cfg.GitDir if set, otherwise cfg.DataDir
+func NewServer(cfg Config) (*Server, error) {
+	cfg.setDefaults()
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("both TLS cert and key files are required, got cert=%q key=%q", cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+
+	var store PageStore
+	var err error
+	if cfg.GitDir != "" {
+		store, err = NewGitStore(cfg.GitDir)
+	} else {
+		store, err = NewFileStore(cfg.DataDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	wk := New(store)
+	if cfg.MaxAttachmentSize > 0 {
+		wk.maxAttachmentSize = cfg.MaxAttachmentSize
+	}
+	if cfg.TOCMinHeadings != 0 {
+		wk.tocMinHeadings = cfg.TOCMinHeadings
+	}
+	if cfg.TemplateDir != "" {
+		if wk.templates, err = parseTemplates(cfg.TemplateDir); err != nil {
+			return nil, fmt.Errorf("error loading templates from %s: %v", cfg.TemplateDir, err)
+		}
+	}
+
+	if cfg.AuthFile != "" {
+		auth, err := LoadAuth(cfg.AuthFile)
+		if err != nil {
+			return nil, err
+		}
+		wk.EnableAuth(auth)
+	}
+
+	s := &Server{
+		Config: cfg,
+		Wiki:   wk,
+		http: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           wk,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+		},
+	}
+	// Event streams never finish on their own, so Shutdown would wait on them until it gives up
+	s.http.RegisterOnShutdown(wk.events.close)
+	return s, nil
+}
+
+// ListenAndServe listens on s.Addr and blocks until the server stops.
+// It returns nil after a Shutdown.
+func (s *Server) ListenAndServe() error {
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l until the server stops
+func (s *Server) Serve(l net.Listener) error {
+	var err error
+	if s.TLSCertFile != "" {
+		err = s.http.ServeTLS(l, s.TLSCertFile, s.TLSKeyFile)
+	} else {
+		err = s.http.Serve(l)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and waits for in-flight requests until ctx is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.http.Shutdown(ctx)
+}
+
+// Run serves until ctx is cancelled and then shuts down, giving in-flight requests
+// ShutdownTimeout to finish so no save is cut off halfway
+func (s *Server) Run(ctx context.Context) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down, waiting up to %s for in-flight requests", s.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.ShutdownTimeout)
+	defer cancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	return <-errc
+}
+
+// Serve starts the wiki with the default Config and stops it gracefully on SIGINT or SIGTERM
+func Serve() {
+	s, err := NewServer(Config{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := s.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// go run ./cmd/wiki -addr :8080 -data ./pages
+// http://localhost:8080/edit/NewPage
@@ -0,0 +1,74 @@
+package web
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerDefaults(t *testing.T) {
+	t.Chdir(t.TempDir())
+	s, err := NewServer(Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, ":8080", s.Addr)
+	assert.Equal(t, ".", s.DataDir)
+	assert.Equal(t, 10*time.Second, s.http.ReadTimeout)
+	assert.Equal(t, 30*time.Second, s.http.WriteTimeout)
+
+	_, err = NewServer(Config{TLSCertFile: "cert.pem"})
+	assert.Error(t, err)
+}
+
+func TestTemplateDirOverrides(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "view.html"), []byte("custom {{.Title}}"), 0600))
+	s, err := NewServer(Config{DataDir: t.TempDir(), TemplateDir: dir})
+	assert.NoError(t, err)
+
+	assert.NoError(t, s.Wiki.save(&Page{Title: "Home", Body: []byte("x")}, anyRevision, "alice", ""))
+	assert.Equal(t, "custom Home", get(t, s.Wiki, "/view/Home").Body.String())
+	// Templates that were not overridden keep working
+	assert.Contains(t, get(t, s.Wiki, "/edit/Home").Body.String(), "Editing Home")
+}
+
+func TestRunShutsDownGracefully(t *testing.T) {
+	s, err := NewServer(Config{Addr: "127.0.0.1:0", DataDir: t.TempDir()})
+	assert.NoError(t, err)
+	l, err := net.Listen("tcp", s.Addr)
+	assert.NoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+
+	addr := "http://" + l.Addr().String()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	rsp, err := client.Get(addr + "/edit/Home")
+	assert.NoError(t, err)
+	form, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	token := regexp.MustCompile(`name="csrf_token" value="([^"]+)"`).FindSubmatch(form)
+	assert.NotNil(t, token)
+	rsp, err = client.PostForm(addr+"/save/Home", url.Values{"body": {"hello"}, "csrf_token": {string(token[1])}})
+	assert.NoError(t, err)
+	rsp.Body.Close()
+	rsp, err = client.Get(addr + "/view/Home")
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	assert.Contains(t, string(body), "hello")
+
+	assert.NoError(t, s.Shutdown(context.Background()))
+	assert.NoError(t, <-done)
+	_, err = http.Get(addr + "/view/Home")
+	assert.Error(t, err)
+}
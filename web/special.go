@@ -0,0 +1,143 @@
+package web
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// specialPageSize is how many entries a special page lists at a time
+const specialPageSize = 100
+
+// specialPage is a generated maintenance list served under /special/
+type specialPage struct {
+	Name        string
+	Heading     string
+	Description string
+	list        func(wk *Wiki, r *http.Request) ([]specialItem, error)
+}
+
+type specialItem struct {
+	Title string
+	Count int // number of linking pages, for WantedPages
+}
+
+var specialPages = []specialPage{
+	{"AllPages", "All pages", "Every page in the wiki in alphabetical order.", (*Wiki).allPages},
+	{"OrphanedPages", "Orphaned pages", "Pages no other page links to.", (*Wiki).orphanedPages},
+	{"WantedPages", "Wanted pages", "Pages that are linked to but have not been written yet, most wanted first.", (*Wiki).wantedPages},
+	{"DeadEndPages", "Dead-end pages", "Pages that do not link to any other page.", (*Wiki).deadEndPages},
+}
+
+// titles returns the pages the requester may read in alphabetical order
+func (wk *Wiki) titles(r *http.Request) ([]string, error) {
+	titles, err := wk.store.Titles()
+	if err != nil {
+		return nil, err
+	}
+	titles = wk.readable(r, titles)
+	slices.Sort(titles)
+	return titles, nil
+}
+
+func (wk *Wiki) allPages(r *http.Request) ([]specialItem, error) {
+	titles, err := wk.titles(r)
+	if err != nil {
+		return nil, err
+	}
+	return titleItems(titles), nil
+}
+
+func (wk *Wiki) orphanedPages(r *http.Request) ([]specialItem, error) {
+	titles, err := wk.titles(r)
+	if err != nil {
+		return nil, err
+	}
+	links := wk.linkIndex()
+	// A page linking to itself is still an orphan
+	return titleItems(slices.DeleteFunc(titles, func(t string) bool {
+		return slices.ContainsFunc(links.backlinks(t), func(s string) bool { return s != t })
+	})), nil
+}
+
+func (wk *Wiki) wantedPages(r *http.Request) ([]specialItem, error) {
+	links := wk.linkIndex()
+	var items []specialItem
+	for _, t := range links.targets() {
+		if wk.pageExists(t) {
+			continue
+		}
+		// Only links from readable pages count, so restricted pages don't leak what they link to
+		if n := len(wk.readable(r, links.backlinks(t))); n > 0 {
+			items = append(items, specialItem{Title: t, Count: n})
+		}
+	}
+	slices.SortStableFunc(items, func(a, b specialItem) int { return cmp.Compare(b.Count, a.Count) })
+	return items, nil
+}
+
+func (wk *Wiki) deadEndPages(r *http.Request) ([]specialItem, error) {
+	titles, err := wk.titles(r)
+	if err != nil {
+		return nil, err
+	}
+	links := wk.linkIndex()
+	return titleItems(slices.DeleteFunc(titles, func(t string) bool {
+		return slices.ContainsFunc(links.links(t), func(target string) bool { return target != t })
+	})), nil
+}
+
+func titleItems(titles []string) []specialItem {
+	items := make([]specialItem, len(titles))
+	for i, t := range titles {
+		items[i] = specialItem{Title: t}
+	}
+	return items
+}
+
+type specialView struct {
+	Special    *specialPage // nil for the index of special pages
+	Items      []specialItem
+	Pages      []specialPage // all special pages, for the index and navigation
+	Start      int           // 1-based position of the first item shown
+	Total      int
+	Page       int
+	Prev, Next int // page numbers, 0 if there is none
+}
+
+// specialHandler serves /special/ with an index of the special pages and /special/{name}?page=N
+func (wk *Wiki) specialHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/special/")
+	v := &specialView{Pages: specialPages}
+	if name == "" {
+		wk.renderTemplate(w, r, "special", v)
+		return
+	}
+	i := slices.IndexFunc(specialPages, func(p specialPage) bool { return p.Name == name })
+	if i < 0 {
+		http.NotFound(w, r)
+		return
+	}
+	v.Special = &specialPages[i]
+	items, err := v.Special.list(wk, r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	v.Page, _ = strconv.Atoi(r.URL.Query().Get("page"))
+	// Pages past the end show the last one, which also keeps the offset below from overflowing
+	v.Page = min(max(v.Page, 1), max(1, (len(items)+specialPageSize-1)/specialPageSize))
+	v.Total = len(items)
+	start := min((v.Page-1)*specialPageSize, len(items))
+	end := min(start+specialPageSize, len(items))
+	v.Items, v.Start = items[start:end], start+1
+	if v.Page > 1 {
+		v.Prev = v.Page - 1
+	}
+	if end < len(items) {
+		v.Next = v.Page + 1
+	}
+	wk.renderTemplate(w, r, "special", v)
+}
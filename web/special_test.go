@@ -0,0 +1,111 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newLinkedWiki returns a wiki where Home links to About and the missing Todo and Ideas,
+// About links back home and to Todo, Lonely links only to itself and Stub links nowhere
+func newLinkedWiki(t *testing.T) *Wiki {
+	t.Helper()
+	wk := newTestWiki(t)
+	for title, body := range map[string]string{
+		"Home":   "[[About]] [[Todo]] [[Ideas]]",
+		"About":  "[[Home]] [[Todo]]",
+		"Lonely": "[[Lonely]]",
+		"Stub":   "nothing yet",
+	} {
+		assert.NoError(t, wk.save(&Page{Title: title, Body: []byte(body)}, anyRevision, "alice", ""))
+	}
+	return wk
+}
+
+func titlesOf(items []specialItem) []string {
+	var titles []string
+	for _, it := range items {
+		titles = append(titles, it.Title)
+	}
+	return titles
+}
+
+func TestSpecialPageLists(t *testing.T) {
+	wk := newLinkedWiki(t)
+	r := httptest.NewRequest(http.MethodGet, "/special/", nil)
+
+	items, err := wk.allPages(r)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"About", "Home", "Lonely", "Stub"}, titlesOf(items))
+
+	items, _ = wk.orphanedPages(r)
+	assert.Equal(t, []string{"Lonely", "Stub"}, titlesOf(items))
+
+	items, _ = wk.wantedPages(r)
+	assert.Equal(t, []specialItem{{Title: "Todo", Count: 2}, {Title: "Ideas", Count: 1}}, items)
+
+	items, _ = wk.deadEndPages(r)
+	assert.Equal(t, []string{"Lonely", "Stub"}, titlesOf(items))
+}
+
+func TestSpecialPagesHandler(t *testing.T) {
+	wk := newLinkedWiki(t)
+	rec := get(t, wk, "/special/")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<a href="/special/WantedPages">Wanted pages</a>`)
+
+	rec = get(t, wk, "/special/WantedPages")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<a class="wikilink missing" href="/edit/Todo">Todo</a> (2 links`)
+
+	assert.Equal(t, http.StatusNotFound, get(t, wk, "/special/Nope").Code)
+}
+
+func TestAllPagesPagination(t *testing.T) {
+	wk := newTestWiki(t)
+	for i := range specialPageSize + 5 {
+		assert.NoError(t, wk.save(&Page{Title: fmt.Sprintf("Page%03d", i), Body: []byte("x")}, anyRevision, "bot", ""))
+	}
+	body := get(t, wk, "/special/AllPages").Body.String()
+	assert.Equal(t, specialPageSize, strings.Count(body, "<li><a href=\"/view/"))
+	assert.Contains(t, body, `<a href="?page=2">next`)
+	assert.NotContains(t, body, "previous")
+
+	body = get(t, wk, "/special/AllPages?page=2").Body.String()
+	assert.Equal(t, 5, strings.Count(body, "<li><a href=\"/view/"))
+	assert.Contains(t, body, `<ol start="101">`)
+	assert.Contains(t, body, `<a href="?page=1">&larr; previous</a>`)
+	assert.NotContains(t, body, "next")
+
+	// Page numbers past the end show the last page
+	for _, page := range []string{"9", "9223372036854775807", "184467440737095517"} {
+		rec := get(t, wk, "/special/AllPages?page="+page)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `<ol start="101">`)
+	}
+
+	// A full last page has no empty page after it
+	wk = newTestWiki(t)
+	for i := range specialPageSize {
+		assert.NoError(t, wk.save(&Page{Title: fmt.Sprintf("Page%03d", i), Body: []byte("x")}, anyRevision, "bot", ""))
+	}
+	body = get(t, wk, "/special/AllPages?page=9").Body.String()
+	assert.Equal(t, specialPageSize, strings.Count(body, "<li><a href=\"/view/"))
+	assert.Contains(t, body, `<ol start="1">`)
+	assert.NotContains(t, body, "next")
+}
+
+func TestSpecialPagesHideUnreadablePages(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	assert.NoError(t, wk.save(&Page{Title: "Secret", Body: []byte("[[Plans]]")}, anyRevision, "admin", ""))
+	assert.NoError(t, wk.save(&Page{Title: "Home", Body: []byte("hi")}, anyRevision, "admin", ""))
+
+	body := get(t, wk, "/special/AllPages").Body.String()
+	assert.Contains(t, body, "Home")
+	assert.NotContains(t, body, "Secret")
+	assert.NotContains(t, get(t, wk, "/special/WantedPages").Body.String(), "Plans")
+}
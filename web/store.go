@@ -0,0 +1,385 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-wiki/storage"
+)
+
+// PageStore persists pages and their revision history.
+// Implementations must be safe for concurrent use; the Wiki serializes saves itself.
+type PageStore interface {
+	// Load returns the current version of a page, or an error wrapping fs.ErrNotExist.
+	// It is called for every page a view links to, so it must not read the whole history.
+	Load(title string) (*Page, error)
+	// Exists reports whether a page is stored, more cheaply than Load
+	Exists(title string) (bool, error)
+	// History returns every revision of a page, oldest first
+	History(title string) ([]Revision, error)
+	// Save appends rev to the history of a page and makes its body current
+	Save(title string, rev Revision) error
+	// Titles lists every stored page
+	Titles() ([]string, error)
+	// Delete removes a page with its history and attachments, or returns an error wrapping fs.ErrNotExist
+	Delete(title string) error
+
+	// Attachments lists the files attached to a page by name
+	Attachments(title string) ([]Attachment, error)
+	// LoadAttachment returns an attached file, or an error wrapping fs.ErrNotExist
+	LoadAttachment(title, name string) (*Attachment, []byte, error)
+	// SaveAttachment attaches a file to a page, replacing any file of the same name
+	SaveAttachment(title string, a Attachment, data []byte) error
+	// DeleteAttachment removes an attached file, or returns an error wrapping fs.ErrNotExist
+	DeleteAttachment(title, name string) error
+}
+
+// FileStore keeps each page in a directory as <key>.txt next to an append-only
+// <key>.history log holding one JSON revision per line, where key is the storageKey of the title,
+// and <key>.rev holding the number of the current revision.
+// Attachments live in a <key>.files directory, each file next to a .json file describing it.
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore returns a FileStore rooted at dir, creating the directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating page directory %s: %v", dir, err)
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// pageFile and historyFile go through storageKey, so no title can name a file outside Dir
+func (f *FileStore) pageFile(title string) string {
+	return filepath.Join(f.Dir, storageKey(title)+".txt")
+}
+
+func (f *FileStore) historyFile(title string) string {
+	return filepath.Join(f.Dir, storageKey(title)+".history")
+}
+
+func (f *FileStore) revisionFile(title string) string {
+	return filepath.Join(f.Dir, storageKey(title)+".rev")
+}
+
+func (f *FileStore) attachmentDir(title string) string {
+	return filepath.Join(f.Dir, storageKey(title)+".files")
+}
+
+func (f *FileStore) attachmentFile(title, name string) string {
+	return filepath.Join(f.attachmentDir(title), storageKey(name))
+}
+
+func (f *FileStore) Load(title string) (*Page, error) {
+	body, err := os.ReadFile(f.pageFile(title))
+	if err != nil {
+		return nil, err
+	}
+	p := &Page{Title: title, Body: body}
+	if data, err := os.ReadFile(f.revisionFile(title)); err == nil {
+		p.Revision, err = strconv.Atoi(strings.TrimSpace(string(data)))
+		if err == nil {
+			return p, nil
+		}
+	}
+	// Pages saved before the revision was kept count their history instead
+	if revs, err := f.History(title); err == nil {
+		p.Revision = len(revs)
+	}
+	return p, nil
+}
+
+func (f *FileStore) Exists(title string) (bool, error) {
+	_, err := os.Stat(f.pageFile(title))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// History includes pages written before history was kept: their current body is revision 1
+func (f *FileStore) History(title string) ([]Revision, error) {
+	file, err := os.Open(f.historyFile(title))
+	if errors.Is(err, fs.ErrNotExist) {
+		legacy, err := f.legacyRevision(title)
+		if legacy == nil {
+			return nil, err
+		}
+		return []Revision{*legacy}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var revs []Revision
+	dec := json.NewDecoder(file)
+	for dec.More() {
+		var rev Revision
+		if err := dec.Decode(&rev); err != nil {
+			return nil, fmt.Errorf("error reading history of %s: %v", title, err)
+		}
+		revs = append(revs, rev)
+	}
+	return revs, nil
+}
+
+func (f *FileStore) legacyRevision(title string) (*Revision, error) {
+	info, err := os.Stat(f.pageFile(title))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	body, err := os.ReadFile(f.pageFile(title))
+	if err != nil {
+		return nil, err
+	}
+	return &Revision{ID: 1, Author: "unknown", Timestamp: info.ModTime(), Summary: "Imported existing page", Body: body}, nil
+}
+
+func (f *FileStore) Save(title string, rev Revision) error {
+	// The legacy revision only exists in memory until the first save writes the log
+	if _, err := os.Stat(f.historyFile(title)); errors.Is(err, fs.ErrNotExist) {
+		legacy, err := f.legacyRevision(title)
+		if err != nil {
+			return err
+		}
+		if legacy != nil {
+			if err := f.appendRevision(title, *legacy); err != nil {
+				return err
+			}
+		}
+	}
+	if err := f.appendRevision(title, rev); err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.pageFile(title), rev.Body, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(f.revisionFile(title), []byte(strconv.Itoa(rev.ID)+"\n"), 0600)
+}
+
+func (f *FileStore) appendRevision(title string, rev Revision) error {
+	file, err := os.OpenFile(f.historyFile(title), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(rev); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (f *FileStore) Titles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(f.Dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	var titles []string
+	for _, file := range files {
+		if title, ok := titleFromKey(strings.TrimSuffix(filepath.Base(file), ".txt")); ok {
+			titles = append(titles, title)
+		}
+	}
+	return titles, nil
+}
+
+func (f *FileStore) Delete(title string) error {
+	if err := os.Remove(f.pageFile(title)); err != nil {
+		return err
+	}
+	for _, file := range []string{f.historyFile(title), f.revisionFile(title)} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return os.RemoveAll(f.attachmentDir(title))
+}
+
+func (f *FileStore) Attachments(title string) ([]Attachment, error) {
+	files, err := filepath.Glob(filepath.Join(f.attachmentDir(title), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var list []Attachment
+	for _, file := range files {
+		a, err := readAttachmentMeta(file)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *a)
+	}
+	sortAttachments(list)
+	return list, nil
+}
+
+func readAttachmentMeta(file string) (*Attachment, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var a Attachment
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", file, err)
+	}
+	return &a, nil
+}
+
+func (f *FileStore) LoadAttachment(title, name string) (*Attachment, []byte, error) {
+	file := f.attachmentFile(title, name)
+	a, err := readAttachmentMeta(file + ".json")
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, data, nil
+}
+
+// SaveAttachment writes the data before the description, so a listed file is always complete
+func (f *FileStore) SaveAttachment(title string, a Attachment, data []byte) error {
+	if err := os.MkdirAll(f.attachmentDir(title), 0700); err != nil {
+		return err
+	}
+	file := f.attachmentFile(title, a.Name)
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		return err
+	}
+	meta, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file+".json", meta, 0600)
+}
+
+func (f *FileStore) DeleteAttachment(title, name string) error {
+	file := f.attachmentFile(title, name)
+	if err := os.Remove(file + ".json"); err != nil {
+		return err
+	}
+	return os.Remove(file)
+}
+
+// StorageStore adapts any storage.Storage to a PageStore. A page is stored as its
+// revision history keyed by title; the current body is the latest revision.
+// Attachments are only kept in memory.
+type StorageStore struct {
+	mu          sync.RWMutex
+	storage     storage.Storage[[]Revision]
+	attachments map[string]map[string]storedAttachment
+}
+
+type storedAttachment struct {
+	Attachment
+	data []byte
+}
+
+// NewStorageStore wraps s, e.g. storage.NewMemory[[]Revision]() for tests
+func NewStorageStore(s storage.Storage[[]Revision]) *StorageStore {
+	return &StorageStore{storage: s, attachments: make(map[string]map[string]storedAttachment)}
+}
+
+func (s *StorageStore) Load(title string) (*Page, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs, exists := s.storage.Get(title)
+	if !exists || len(revs) == 0 {
+		return nil, fmt.Errorf("page %s: %w", title, fs.ErrNotExist)
+	}
+	latest := revs[len(revs)-1]
+	return &Page{Title: title, Body: latest.Body, Revision: latest.ID}, nil
+}
+
+func (s *StorageStore) Exists(title string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs, exists := s.storage.Get(title)
+	return exists && len(revs) > 0, nil
+}
+
+func (s *StorageStore) History(title string) ([]Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revs, _ := s.storage.Get(title)
+	return slices.Clone(revs), nil
+}
+
+func (s *StorageStore) Save(title string, rev Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	revs, _ := s.storage.Get(title)
+	// Copy so callers holding an earlier History never see it change
+	s.storage.Put(title, append(slices.Clone(revs), rev))
+	return nil
+}
+
+func (s *StorageStore) Titles() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.storage.Keys(), nil
+}
+
+func (s *StorageStore) Delete(title string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.storage.Delete(title) {
+		return fmt.Errorf("page %s: %w", title, fs.ErrNotExist)
+	}
+	delete(s.attachments, title)
+	return nil
+}
+
+func (s *StorageStore) Attachments(title string) ([]Attachment, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var list []Attachment
+	for _, a := range s.attachments[title] {
+		list = append(list, a.Attachment)
+	}
+	sortAttachments(list)
+	return list, nil
+}
+
+func (s *StorageStore) LoadAttachment(title, name string) (*Attachment, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	a, exists := s.attachments[title][name]
+	if !exists {
+		return nil, nil, fmt.Errorf("attachment %s of %s: %w", name, title, fs.ErrNotExist)
+	}
+	return &a.Attachment, a.data, nil
+}
+
+func (s *StorageStore) SaveAttachment(title string, a Attachment, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attachments[title] == nil {
+		s.attachments[title] = make(map[string]storedAttachment)
+	}
+	s.attachments[title][a.Name] = storedAttachment{Attachment: a, data: slices.Clone(data)}
+	return nil
+}
+
+func (s *StorageStore) DeleteAttachment(title, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.attachments[title][name]; !exists {
+		return fmt.Errorf("attachment %s of %s: %w", name, title, fs.ErrNotExist)
+	}
+	delete(s.attachments[title], name)
+	return nil
+}
@@ -0,0 +1,135 @@
+package web
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-wiki/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testPageStore exercises the PageStore contract every backend must satisfy
+func testPageStore(t *testing.T, s PageStore) {
+	_, err := s.Load("Home")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	exists, err := s.Exists("Home")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	revs, err := s.History("Home")
+	assert.NoError(t, err)
+	assert.Empty(t, revs)
+
+	assert.NoError(t, s.Save("Home", Revision{ID: 1, Author: "alice", Body: []byte("first")}))
+	assert.NoError(t, s.Save("Home", Revision{ID: 2, Author: "bob", Body: []byte("second")}))
+	assert.NoError(t, s.Save("Other", Revision{ID: 1, Body: []byte("other")}))
+
+	p, err := s.Load("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(p.Body))
+	assert.Equal(t, 2, p.Revision)
+	exists, _ = s.Exists("Home")
+	assert.True(t, exists)
+
+	revs, err = s.History("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(revs))
+	assert.Equal(t, "alice", revs[0].Author)
+	assert.Equal(t, "first", string(revs[0].Body))
+
+	titles, err := s.Titles()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Home", "Other"}, titles)
+
+	// Saving unchanged text is a revision of its own
+	assert.NoError(t, s.Save("Home", Revision{ID: 3, Author: "carol", Summary: "null edit", Body: []byte("second")}))
+	revs, _ = s.History("Home")
+	assert.Equal(t, 3, len(revs))
+	assert.Equal(t, "null edit", revs[2].Summary)
+	assert.Equal(t, "second", string(revs[2].Body))
+	p, _ = s.Load("Home")
+	assert.Equal(t, 3, p.Revision)
+
+	files, err := s.Attachments("Home")
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.NoError(t, s.SaveAttachment("Home", Attachment{Name: "b.txt", ContentType: "text/plain", Size: 2}, []byte("v1")))
+	assert.NoError(t, s.SaveAttachment("Home", Attachment{Name: "b.txt", ContentType: "text/plain", Size: 2}, []byte("v2")))
+	assert.NoError(t, s.SaveAttachment("Home", Attachment{Name: "a diagram.png", ContentType: "image/png"}, []byte("png")))
+	assert.NoError(t, s.SaveAttachment("Other", Attachment{Name: "c.log"}, []byte("log")))
+	files, _ = s.Attachments("Home")
+	assert.Equal(t, 2, len(files))
+	assert.Equal(t, "a diagram.png", files[0].Name)
+	a, data, err := s.LoadAttachment("Home", "b.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "text/plain", a.ContentType)
+	assert.Equal(t, "v2", string(data))
+	assert.NoError(t, s.DeleteAttachment("Home", "b.txt"))
+	assert.ErrorIs(t, s.DeleteAttachment("Home", "b.txt"), fs.ErrNotExist)
+	_, _, err = s.LoadAttachment("Home", "b.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NoError(t, s.Delete("Other"))
+	assert.ErrorIs(t, s.Delete("Other"), fs.ErrNotExist)
+	files, _ = s.Attachments("Other")
+	assert.Empty(t, files, "attachments go with their page")
+	_, err = s.Load("Other")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	exists, _ = s.Exists("Other")
+	assert.False(t, exists)
+	revs, _ = s.History("Other")
+	assert.Empty(t, revs)
+	titles, _ = s.Titles()
+	assert.Equal(t, []string{"Home"}, titles)
+}
+
+func TestFileStore(t *testing.T) {
+	s, err := NewFileStore(filepath.Join(t.TempDir(), "pages"))
+	assert.NoError(t, err)
+	testPageStore(t, s)
+}
+
+func TestStorageStore(t *testing.T) {
+	testPageStore(t, NewStorageStore(storage.NewMemory[[]Revision]()))
+}
+
+func TestFileStoreImportsLegacyPages(t *testing.T) {
+	dir := t.TempDir()
+	// A page written before history was kept
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Old.txt"), []byte("legacy"), 0600))
+	s, _ := NewFileStore(dir)
+
+	revs, err := s.History("Old")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(revs))
+
+	wk := New(s)
+	assert.NoError(t, wk.save(&Page{Title: "Old", Body: []byte("new")}, 1, "bob", ""))
+
+	revs, _ = s.History("Old")
+	assert.Equal(t, 2, len(revs))
+	assert.Equal(t, "legacy", string(revs[0].Body))
+	assert.Equal(t, "new", string(revs[1].Body))
+}
+
+func TestFileStoreLoadSkipsHistory(t *testing.T) {
+	dir := t.TempDir()
+	s, _ := NewFileStore(dir)
+	assert.NoError(t, s.Save("Home", Revision{ID: 1, Body: []byte("first")}))
+	assert.NoError(t, s.Save("Home", Revision{ID: 2, Body: []byte("second")}))
+
+	// Load reads the revision number rather than decoding the history
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "Home.history"), []byte("not json"), 0600))
+	p, err := s.Load("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, p.Revision)
+
+	// Pages saved before the number was kept still count their history
+	assert.NoError(t, s.Save("Old", Revision{ID: 1, Body: []byte("a")}))
+	assert.NoError(t, s.Save("Old", Revision{ID: 2, Body: []byte("b")}))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "Old.rev")))
+	p, _ = s.Load("Old")
+	assert.Equal(t, 2, p.Revision)
+}
@@ -0,0 +1,88 @@
+package web
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Page titles are kept in one canonical display form such as "Release Notes/2026": words are
+// separated by single spaces and "/" separates namespaces. In URLs spaces become underscores
+// ("/view/Release_Notes/2026"), so titles cannot contain "_" themselves.
+
+// maxTitleLen is the limit in bytes; it keeps storage file names under the usual 255 byte limit
+const maxTitleLen = 80
+
+// titleSpecials may not appear in titles because they have a meaning in URLs or wiki markup
+const titleSpecials = "#?%[]{}|<>\"\\"
+
+// normalizeTitle turns a title as typed or taken from a URL into its canonical form,
+// reporting false if it is not a valid title
+func normalizeTitle(s string) (string, bool) {
+	if !utf8.ValidString(s) {
+		return "", false
+	}
+	segments := strings.Split(strings.ReplaceAll(s, "_", " "), "/")
+	for i, seg := range segments {
+		seg = strings.Join(strings.Fields(seg), " ")
+		if seg == "" || seg == "." || seg == ".." {
+			return "", false
+		}
+		for _, r := range seg {
+			if !unicode.IsPrint(r) || strings.ContainsRune(titleSpecials, r) {
+				return "", false
+			}
+		}
+		segments[i] = seg
+	}
+	title := strings.Join(segments, "/")
+	if len(title) > maxTitleLen {
+		return "", false
+	}
+	return title, true
+}
+
+// validTitle reports whether s is a title in canonical form
+func validTitle(s string) bool {
+	title, ok := normalizeTitle(s)
+	return ok && title == s
+}
+
+// slug returns the escaped URL path of a title, e.g. "Caf%C3%A9/Opening_hours"
+func slug(title string) string {
+	segments := strings.Split(strings.ReplaceAll(title, " ", "_"), "/")
+	for i, seg := range segments {
+		segments[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// storageKey maps a title to a flat name that is safe as a file name on any system:
+// ASCII letters, digits and "-" are kept, spaces become "_" and every other byte,
+// including "/" and ".", is written as %XX. Plain alphanumeric titles map to themselves.
+func storageKey(title string) string {
+	var b strings.Builder
+	for i := 0; i < len(title); i++ {
+		c := title[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '-':
+			b.WriteByte(c)
+		case c == ' ':
+			b.WriteByte('_')
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// titleFromKey reverses storageKey, reporting false for names it did not produce
+func titleFromKey(key string) (string, bool) {
+	title, err := url.PathUnescape(strings.ReplaceAll(key, "_", " "))
+	if err != nil || storageKey(title) != key || !validTitle(title) {
+		return "", false
+	}
+	return title, true
+}
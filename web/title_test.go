@@ -0,0 +1,120 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	valid := map[string]string{
+		"Home":                      "Home",
+		"Release_Notes/2026":        "Release Notes/2026",
+		"  Release   Notes / 2026 ": "Release Notes/2026",
+		"Café":                      "Café",
+		"on-call-runbook":           "on-call-runbook",
+		"Team/Infra/Runbook":        "Team/Infra/Runbook",
+		"Template:Infobox":          "Template:Infobox",
+		"v1.2":                      "v1.2",
+		"tab\there":                 "tab here",
+	}
+	for in, want := range valid {
+		got, ok := normalizeTitle(in)
+		assert.True(t, ok, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	for _, in := range []string{"", " ", "/Home", "Home/", "Team//Infra", "..", "Team/../etc", "./Home",
+		"a#b", "a?b", "a%2Fb", "[[x]]", "a|b", "bell\a", "\xff", strings.Repeat("x", maxTitleLen+1)} {
+		_, ok := normalizeTitle(in)
+		assert.False(t, ok, in)
+	}
+	assert.True(t, validTitle("Release Notes"))
+	assert.False(t, validTitle("Release_Notes"))
+}
+
+func TestSlug(t *testing.T) {
+	assert.Equal(t, "Home", slug("Home"))
+	assert.Equal(t, "Release_Notes/2026", slug("Release Notes/2026"))
+	assert.Equal(t, "Caf%C3%A9", slug("Café"))
+	assert.Equal(t, "a%3Bb", slug("a;b"))
+}
+
+func TestStorageKey(t *testing.T) {
+	assert.Equal(t, "Home", storageKey("Home"), "existing page files keep their names")
+	for _, title := range []string{"Release Notes/2026", "Café", "on-call-runbook", "Team/Infra/Runbook", "v1.2"} {
+		key := storageKey(title)
+		assert.NotContains(t, key, "/")
+		assert.NotContains(t, key, ".")
+		back, ok := titleFromKey(key)
+		assert.True(t, ok, key)
+		assert.Equal(t, title, back)
+	}
+	// Names storageKey never produces are ignored
+	for _, key := range []string{"a b", "x%2e", "%2E%2E", "Release_Notes_"} {
+		_, ok := titleFromKey(key)
+		assert.False(t, ok, key)
+	}
+}
+
+func TestFileStoreNamespacedTitles(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileStore(filepath.Join(dir, "pages"))
+	assert.NoError(t, err)
+	for _, title := range []string{"Team/Infra/Runbook", "Café", "../escape"} {
+		assert.NoError(t, s.Save(title, Revision{ID: 1, Body: []byte(title)}))
+	}
+	// Everything stays in one flat directory
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 1, len(entries))
+	titles, err := s.Titles()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Team/Infra/Runbook", "Café"}, titles)
+	p, err := s.Load("Team/Infra/Runbook")
+	assert.NoError(t, err)
+	assert.Equal(t, "Team/Infra/Runbook", string(p.Body))
+}
+
+func TestUnicodeAndNamespacedPages(t *testing.T) {
+	h := newTestWiki(t)
+	rec := post(t, h, "/save/Release_Notes/2026", url.Values{"body": {"See [[Café]] and [[Team/Infra/Runbook|the runbook]]."}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/view/Release_Notes/2026", rec.Header().Get("Location"))
+	assert.True(t, h.pageExists("Release Notes/2026"))
+
+	post(t, h, "/save/Caf%C3%A9", url.Values{"body": {"coffee"}})
+	assert.True(t, h.pageExists("Café"))
+
+	rec = get(t, h, "/view/Release_Notes/2026")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "<h1>Release Notes/2026</h1>")
+	assert.Contains(t, body, `href="/edit/Release_Notes/2026"`)
+	assert.Contains(t, body, `<a class="wikilink" href="/view/Caf%C3%A9">Café</a>`)
+	assert.Contains(t, body, `<a class="wikilink missing" href="/edit/Team/Infra/Runbook"`)
+	assert.Contains(t, get(t, h, "/backlinks/Caf%C3%A9").Body.String(), `href="/view/Release_Notes/2026"`)
+
+	// Other spellings redirect to the canonical URL
+	rec = get(t, h, "/view/Release%20Notes/2026?rev=1")
+	assert.Equal(t, http.StatusMovedPermanently, rec.Code)
+	assert.Equal(t, "/view/Release_Notes/2026?rev=1", rec.Header().Get("Location"))
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/view/a%23b").Code)
+	assert.Equal(t, http.StatusNotFound, post(t, h, "/save/Team/%2E%2E/x", url.Values{"body": {"x"}}).Code)
+}
+
+func TestAPINamespacedTitles(t *testing.T) {
+	h := newTestWiki(t)
+	rec := apiRequest(t, h, http.MethodPost, "/api/v1/pages", `{"title":"Team/Infra/On call","body":"x"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "/api/v1/pages/Team/Infra/On_call", rec.Header().Get("Location"))
+
+	rec = apiRequest(t, h, http.MethodGet, "/api/v1/pages/Team/Infra/On_call", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "Team/Infra/On call", decodePage(t, rec).Title)
+}
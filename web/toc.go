@@ -0,0 +1,111 @@
+package web
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// defaultTOCMinHeadings is how many headings a page needs to get a table of contents unless
+// Config.TOCMinHeadings says otherwise
+const defaultTOCMinHeadings = 4
+
+// heading is a heading of a rendered page with the anchor it can be linked to by
+type heading struct {
+	Level    int
+	Text     string
+	ID       string
+	Children []*heading // the headings nested under it, in the table of contents
+}
+
+// anchorSlugs gives headings anchors made from their text, e.g. "Roll back" becomes "roll-back".
+// Like on GitHub, letters and digits are kept and other punctuation is dropped, so anchors of
+// Unicode headings stay readable. A repeated heading gets a numbered suffix so each anchor is
+// unique on the page.
+type anchorSlugs map[string]bool
+
+// pageAnchors are the ids view.html gives its own elements, which headings never get
+var pageAnchors = []string{"wiki-updated"}
+
+func newAnchorSlugs() anchorSlugs {
+	seen := anchorSlugs{}
+	for _, id := range pageAnchors {
+		seen[id] = true
+	}
+	return seen
+}
+
+func (seen anchorSlugs) anchor(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		case unicode.IsSpace(r) || r == '-' || r == '_':
+			dash = true
+		}
+	}
+	id := b.String()
+	if id == "" {
+		id = "section"
+	}
+	for i, base := 2, id; seen[id]; i++ {
+		id = base + "-" + strconv.Itoa(i)
+	}
+	seen[id] = true
+	return id
+}
+
+// headingText returns the plain text of a heading, with wiki links by their label
+func headingText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch c := c.(type) {
+		case *ast.Text:
+			b.Write(c.Segment.Value(source))
+			if c.SoftLineBreak() || c.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(c.Value)
+		case *wikiLink:
+			b.WriteString(c.Label)
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// tableOfContents nests headings under the nearest preceding heading of a higher level,
+// or returns nil if the page has too few headings to need one
+func (wk *Wiki) tableOfContents(headings []heading) []*heading {
+	if wk.tocMinHeadings <= 0 || len(headings) < wk.tocMinHeadings {
+		return nil
+	}
+	var roots, stack []*heading
+	for i := range headings {
+		h := &headings[i]
+		h.Children = nil
+		for len(stack) > 0 && stack[len(stack)-1].Level >= h.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			roots = append(roots, h)
+		} else {
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, h)
+		}
+		stack = append(stack, h)
+	}
+	return roots
+}
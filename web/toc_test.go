@@ -0,0 +1,59 @@
+package web
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnchors(t *testing.T) {
+	seen := anchorSlugs{}
+	assert.Equal(t, "rollback", seen.anchor("Rollback"))
+	assert.Equal(t, "roll-back-v12", seen.anchor("Roll back (v1.2)!"))
+	assert.Equal(t, "café-menü", seen.anchor("Café — Menü"))
+	assert.Equal(t, "section", seen.anchor("???"))
+	assert.Equal(t, "rollback-2", seen.anchor("Rollback"))
+	assert.Equal(t, "rollback-3", seen.anchor("rollback"))
+}
+
+func TestRenderedHeadings(t *testing.T) {
+	body := "# Deploy\n\n## Steps with [[Home|the home page]] and `code`\n\n## Steps with [[Home|the home page]] and `code`\n"
+	html, headings, err := renderMarkdown("Test", []byte(body), noPages)
+	assert.NoError(t, err)
+	assert.Equal(t, []heading{
+		{Level: 1, Text: "Deploy", ID: "deploy"},
+		{Level: 2, Text: "Steps with the home page and code", ID: "steps-with-the-home-page-and-code"},
+		{Level: 2, Text: "Steps with the home page and code", ID: "steps-with-the-home-page-and-code-2"},
+	}, headings)
+	assert.Contains(t, string(html), `<h2 id="steps-with-the-home-page-and-code-2">`)
+}
+
+func TestTableOfContents(t *testing.T) {
+	wk := newTestWiki(t)
+	headings := []heading{{Level: 2, Text: "A"}, {Level: 3, Text: "A1"}, {Level: 4, Text: "A1x"}, {Level: 3, Text: "A2"}, {Level: 2, Text: "B"}}
+	toc := wk.tableOfContents(headings)
+	assert.Equal(t, 2, len(toc))
+	assert.Equal(t, "A", toc[0].Text)
+	assert.Equal(t, []string{"A1", "A2"}, []string{toc[0].Children[0].Text, toc[0].Children[1].Text})
+	assert.Equal(t, "A1x", toc[0].Children[0].Children[0].Text)
+	assert.Empty(t, toc[1].Children)
+
+	assert.Nil(t, wk.tableOfContents(headings[:3]))
+	wk.tocMinHeadings = -1
+	assert.Nil(t, wk.tableOfContents(headings))
+}
+
+func TestViewTableOfContents(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Runbook", url.Values{"body": {"## Deploy\n\n## Verify\n\n### Metrics\n\n## Rollback\n"}})
+	body := get(t, h, "/view/Runbook").Body.String()
+	assert.Contains(t, body, `<details class="toc" open>`)
+	assert.Contains(t, body, "<li><a href=\"#verify\">Verify</a>\n<ol>\n<li><a href=\"#metrics\">Metrics</a></li>\n</ol></li>")
+	assert.Contains(t, body, `<h2 id="rollback">Rollback</h2>`)
+
+	post(t, h, "/save/Short", url.Values{"body": {"## One\n\n## Two\n"}})
+	body = get(t, h, "/view/Short").Body.String()
+	assert.NotContains(t, body, `class="toc"`)
+	assert.Contains(t, body, `<h2 id="two">Two</h2>`)
+}
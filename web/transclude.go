@@ -0,0 +1,200 @@
+package web
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// templatePrefix starts the title of every page that can be transcluded with {{Template:Name}}
+const templatePrefix = "Template:"
+
+const (
+	maxTemplateDepth = 10  // templates calling templates
+	maxTemplateCalls = 500 // calls expanded for one page, so a few nested calls cannot multiply without bound
+)
+
+// templateParam matches {{{name}}} or {{{name|default}}} in a template body
+var templateParam = regexp.MustCompile(`\{\{\{([^{}|]+)(?:\|([^{}]*))?\}\}\}`)
+
+// transcluder expands {{Template:Name|arg|name=value}} calls in page source before it is rendered
+type transcluder struct {
+	load  func(title string) ([]byte, bool)
+	calls int
+}
+
+// expand replaces the template calls in body; stack holds the templates being expanded, innermost last.
+// Calls inside code are left alone.
+func (t *transcluder) expand(body []byte, stack []string) []byte {
+	if !bytes.Contains(body, []byte("{{"+templatePrefix)) {
+		return body
+	}
+	code := codeRanges(body)
+	var out bytes.Buffer
+	last := 0
+	for i := 0; i < len(body); {
+		j := bytes.Index(body[i:], []byte("{{"+templatePrefix))
+		if j < 0 {
+			break
+		}
+		start := i + j
+		end, parts := scanTemplateCall(body, start)
+		if end < 0 || slices.ContainsFunc(code, func(c [2]int) bool { return start >= c[0] && start < c[1] }) {
+			i = start + 2
+			continue
+		}
+		out.Write(body[last:start])
+		out.Write(t.call(body[start:end], parts, stack))
+		last, i = end, end
+	}
+	out.Write(body[last:])
+	return out.Bytes()
+}
+
+// call expands one template call. Problems are reported in the page where the call was.
+func (t *transcluder) call(raw []byte, parts []string, stack []string) []byte {
+	title, ok := normalizeTitle(strings.TrimSpace(parts[0]))
+	if !ok || !strings.HasPrefix(title, templatePrefix) {
+		return raw
+	}
+	link := "[[" + title + "]]"
+	switch {
+	case slices.Contains(stack, title):
+		return []byte("**Template loop:** " + link)
+	case len(stack) >= maxTemplateDepth:
+		return []byte("**Templates nested too deeply:** " + link)
+	case t.calls >= maxTemplateCalls:
+		return []byte("**Too many templates on this page:** " + link)
+	}
+	t.calls++
+	body, ok := t.load(title)
+	if !ok {
+		return []byte(link)
+	}
+	_, body = splitFrontMatter(body)
+
+	args := map[string]string{}
+	n := 1
+	for _, p := range parts[1:] {
+		if name, value, found := strings.Cut(p, "="); found && !strings.ContainsAny(name, "[{") {
+			args[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		} else {
+			args[strconv.Itoa(n)] = p
+			n++
+		}
+	}
+	body = templateParam.ReplaceAllFunc(body, func(m []byte) []byte {
+		sub := templateParam.FindSubmatchIndex(m)
+		if v, ok := args[strings.TrimSpace(string(m[sub[2]:sub[3]]))]; ok {
+			return []byte(v)
+		}
+		if sub[4] >= 0 {
+			return m[sub[4]:sub[5]]
+		}
+		return nil
+	})
+	return bytes.TrimRight(t.expand(body, append(stack, title)), "\r\n")
+}
+
+// scanTemplateCall finds the end of the call starting at start and splits its contents at the
+// pipes that are not inside a nested call or a [[link|label]]. It returns -1 if the call is not closed.
+func scanTemplateCall(s []byte, start int) (int, []string) {
+	var parts []string
+	braces, links := 1, 0
+	from := start + 2
+	for i := from; i < len(s); {
+		switch {
+		case bytes.HasPrefix(s[i:], []byte("{{")):
+			braces++
+			i += 2
+		case bytes.HasPrefix(s[i:], []byte("}}")):
+			braces--
+			if braces == 0 {
+				return i + 2, append(parts, string(s[from:i]))
+			}
+			i += 2
+		case bytes.HasPrefix(s[i:], []byte("[[")):
+			links++
+			i += 2
+		case bytes.HasPrefix(s[i:], []byte("]]")) && links > 0:
+			links--
+			i += 2
+		case s[i] == '|' && braces == 1 && links == 0:
+			parts = append(parts, string(s[from:i]))
+			from = i + 1
+			i++
+		default:
+			i++
+		}
+	}
+	return -1, nil
+}
+
+// codeRanges returns the byte ranges of code spans and code blocks in body
+func codeRanges(body []byte) [][2]int {
+	var ranges [][2]int
+	doc := markdown.Parser().Parse(text.NewReader(body))
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			if lines := n.Lines(); lines.Len() > 0 {
+				ranges = append(ranges, [2]int{lines.At(0).Start, lines.At(lines.Len() - 1).Stop})
+			}
+			return ast.WalkSkipChildren, nil
+		case *ast.CodeSpan:
+			for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+				if t, ok := c.(*ast.Text); ok {
+					ranges = append(ranges, [2]int{t.Segment.Start, t.Segment.Stop})
+				}
+			}
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return ranges
+}
+
+// expandTemplates expands the template calls in body with the template pages the requester may read
+func (wk *Wiki) expandTemplates(r *http.Request, body []byte) []byte {
+	t := &transcluder{load: func(title string) ([]byte, bool) {
+		if !wk.allowed(r, title, readAccess) {
+			return nil, false
+		}
+		p, err := wk.loadPage(title)
+		if err != nil {
+			return nil, false
+		}
+		return p.Body, true
+	}}
+	return t.expand(body, nil)
+}
+
+// renderPage renders a page body for the requester with its templates expanded
+func (wk *Wiki) renderPage(r *http.Request, title string, body []byte) (template.HTML, []heading, error) {
+	return renderMarkdown(title, wk.expandTemplates(r, body), wk.pageExists)
+}
+
+// templateNames lists the templates the requester may read without the Template: prefix
+func (wk *Wiki) templateNames(r *http.Request) ([]string, error) {
+	titles, err := wk.titles(r)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, title := range titles {
+		if name, ok := strings.CutPrefix(title, templatePrefix); ok {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func expandWith(pages map[string]string, body string) string {
+	t := &transcluder{load: func(title string) ([]byte, bool) {
+		body, ok := pages[title]
+		return []byte(body), ok
+	}}
+	return string(t.expand([]byte(body), nil))
+}
+
+func TestExpandTemplates(t *testing.T) {
+	pages := map[string]string{
+		"Template:Incident": "---\ntags: [Templates]\n---\n**Severity {{{severity|unknown}}}**, owner {{{owner}}}, first {{{1}}}\n",
+		"Template:Warning":  "> Warning: {{{1}}}",
+		"Template:Outer":    "outer({{Template:Inner|{{{1}}}}})",
+		"Template:Inner":    "inner {{{1}}}",
+		"Template:Loop":     "again {{Template:Loop}}",
+		"Template:Deep":     "{{Template:Deep2}}",
+		"Template:Deep2":    "{{Template:Deep}}",
+	}
+	assert.Equal(t, "Before **Severity 2**, owner ops, first extra after",
+		expandWith(pages, "Before {{Template:Incident|severity=2| owner = ops |extra}} after"))
+	assert.Equal(t, "**Severity unknown**, owner , first ", expandWith(pages, "{{Template:Incident}}"))
+	assert.Equal(t, "> Warning: see [[Runbook|the runbook]]", expandWith(pages, "{{Template:Warning|see [[Runbook|the runbook]]}}"))
+	assert.Equal(t, "outer(inner x)", expandWith(pages, "{{Template:Outer|x}}"))
+	assert.Equal(t, "outer(inner > Warning: y)", expandWith(pages, "{{Template:Outer|{{Template:Warning|y}}}}"))
+
+	// Problems show up where the call was
+	assert.Equal(t, "[[Template:Missing]]", expandWith(pages, "{{Template:Missing}}"))
+	assert.Equal(t, "again **Template loop:** [[Template:Loop]]", expandWith(pages, "{{Template:Loop}}"))
+	assert.Contains(t, expandWith(pages, "{{Template:Deep}}"), "**Template loop:** [[Template:Deep]]")
+
+	// Code, unclosed calls and other pages are left alone
+	for _, body := range []string{"`{{Template:Warning|x}}`", "```\n{{Template:Warning|x}}\n```\n", "{{Template:Warning|x", "{{Home}}"} {
+		assert.Equal(t, body, expandWith(pages, body))
+	}
+}
+
+func TestTemplateLimits(t *testing.T) {
+	pages := map[string]string{}
+	for i := 0; i <= maxTemplateDepth; i++ {
+		pages["Template:L"+string(rune('a'+i))] = "{{Template:L" + string(rune('a'+i+1)) + "}}"
+	}
+	assert.Contains(t, expandWith(pages, "{{Template:La}}"), "**Templates nested too deeply:**")
+
+	// Each level calls the next one ten times
+	pages = map[string]string{
+		"Template:A": strings.Repeat("{{Template:B}}", 10),
+		"Template:B": strings.Repeat("{{Template:C}}", 10),
+		"Template:C": strings.Repeat("{{Template:D}}", 10),
+		"Template:D": "d",
+	}
+	out := expandWith(pages, "{{Template:A}}")
+	assert.Contains(t, out, "**Too many templates on this page:**")
+	assert.Less(t, strings.Count(out, "d"), maxTemplateCalls)
+}
+
+func TestTransclusionInView(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Template:Warning", url.Values{"body": {"**Careful:** {{{1}}}"}})
+	post(t, h, "/save/Database", url.Values{"body": {"{{Template:Warning|backups first}}\n\nText."}})
+
+	body := get(t, h, "/view/Database").Body.String()
+	assert.Contains(t, body, "<p><strong>Careful:</strong> backups first</p>")
+	assert.NotContains(t, body, "{{")
+}
+
+func TestTransclusionNeedsReadAccess(t *testing.T) {
+	wk, _ := newAuthWiki(t)
+	admin := loginAs(t, wk, "admin")
+	as(t, wk, admin, http.MethodPost, "/save/Template:Secret", url.Values{"body": {"hunter2"}})
+	wk.auth.SetRules([]Rule{{Pattern: "Template:Secret", Read: Admin, Edit: Admin}})
+	as(t, wk, admin, http.MethodPost, "/save/Notes", url.Values{"body": {"{{Template:Secret}}"}})
+
+	assert.NotContains(t, get(t, wk, "/view/Notes").Body.String(), "hunter2")
+	assert.Contains(t, as(t, wk, admin, http.MethodGet, "/view/Notes", nil).Body.String(), "hunter2")
+}
+
+func TestEditFromTemplate(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Template:Incident", url.Values{"body": {"## Impact\n\n## Timeline\n"}})
+
+	body := get(t, h, "/edit/Outage").Body.String()
+	assert.Contains(t, body, `<option>Incident</option>`)
+
+	body = get(t, h, "/edit/Outage?template=Incident").Body.String()
+	assert.Contains(t, body, "## Impact\n\n## Timeline\n</textarea>")
+	assert.Contains(t, body, `<option selected>Incident</option>`)
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/edit/Outage?template=Missing").Code)
+
+	// Existing pages keep their text
+	post(t, h, "/save/Outage", url.Values{"body": {"done"}})
+	body = get(t, h, "/edit/Outage?template=Incident").Body.String()
+	assert.Contains(t, body, "done</textarea>")
+	assert.NotContains(t, body, "<select")
+}
@@ -1,90 +1,421 @@
 package web
 
 import (
+	"bytes"
+	"embed"
+	"errors"
 	"html/template"
-	"log"
+	"io/fs"
+	"net"
 	"net/http"
-	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	elastic "go-wiki/elasticsearch"
 )
 
 type Page struct {
-	Title string
-	Body  []byte
+	Title    string
+	Body     []byte
+	Revision int // ID of the revision Body belongs to, 0 if never saved
+}
+
+// Wiki serves the pages of a PageStore over HTTP
+type Wiki struct {
+	store     PageStore
+	templates *template.Template
+	mux       *http.ServeMux
+	auth      *Auth // nil leaves the wiki open to everyone
+	csrfKey   []byte
+
+	maxAttachmentSize int64
+	tocMinHeadings    int // pages with fewer headings get no table of contents; 0 or less turns it off
+
+	// saveMu serializes saves so revision IDs are assigned without gaps or duplicates
+	saveMu sync.Mutex
+
+	links          *linkGraph
+	linksOnce      sync.Once
+	categories     *linkGraph // pages to the categories they are in
+	categoriesOnce sync.Once
+	searchIndex    string // name of the elastic index of this wiki's pages
+	searchOnce     sync.Once
+
+	events *eventHub // open /events streams
 }
 
-func (p *Page) save() error {
-	filename := p.Title + ".txt"
-	return os.WriteFile(filename, p.Body, 0600)
+// New returns a Wiki backed by store
+func New(store PageStore) *Wiki {
+	wk := &Wiki{store: store, templates: templates, csrfKey: newSecretKey(), maxAttachmentSize: defaultMaxAttachmentSize, tocMinHeadings: defaultTOCMinHeadings, events: newEventHub(), searchIndex: newSearchIndexName()}
+	wk.mux = wk.routes()
+	return wk
 }
 
-func loadPage(title string) (*Page, error) {
-	filename := title + ".txt"
-	body, err := os.ReadFile(filename)
+func (wk *Wiki) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	wk.mux.ServeHTTP(w, wk.identify(r))
+}
+
+// save records the body as a new revision of the page and updates the link graph and search index.
+// base is the revision the edit started from; if the page has moved on since, save returns errEditConflict.
+func (wk *Wiki) save(p *Page, base int, author, summary string) error {
+	wk.saveMu.Lock()
+	defer wk.saveMu.Unlock()
+	return wk.saveLocked(p, base, author, summary)
+}
+
+// saveLocked is save for callers already holding saveMu
+func (wk *Wiki) saveLocked(p *Page, base int, author, summary string) error {
+	history, err := wk.store.History(p.Title)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if err := checkBase(history, base); err != nil {
+		return err
+	}
+	rev := Revision{
+		ID:        len(history) + 1,
+		Author:    author,
+		Timestamp: time.Now(),
+		Summary:   summary,
+		Body:      p.Body,
 	}
-	return &Page{Title: title, Body: body}, nil
+	if err := wk.store.Save(p.Title, rev); err != nil {
+		return err
+	}
+	p.Revision = rev.ID
+	wk.indexLinks(p.Title, p.Body)
+	wk.publishSaved(p, author)
+	return wk.indexPage(p)
 }
 
-func renderTemplate(w http.ResponseWriter, tmpl string, p *Page) {
-	err := templates.ExecuteTemplate(w, tmpl+".html", p)
+// delete removes a page and drops it from the link graph and search index
+func (wk *Wiki) delete(title string, base int) error {
+	wk.saveMu.Lock()
+	defer wk.saveMu.Unlock()
+
+	history, err := wk.store.History(title)
 	if err != nil {
+		return err
+	}
+	if len(history) > 0 {
+		if err := checkBase(history, base); err != nil {
+			return err
+		}
+	}
+	if err := wk.store.Delete(title); err != nil {
+		return err
+	}
+	wk.indexLinks(title, nil)
+	wk.publishDeleted(title)
+	wk.loadSearchIndex()
+	return elastic.DeleteDocument(wk.searchIndex, title)
+}
+
+func (wk *Wiki) loadPage(title string) (*Page, error) {
+	return wk.store.Load(title)
+}
+
+func (wk *Wiki) pageExists(title string) bool {
+	exists, err := wk.store.Exists(title)
+	return exists && err == nil
+}
+
+// pageView is the data passed to the view and edit templates
+type pageView struct {
+	*Page
+	OldRevision *Revision     // set when an old revision is being viewed
+	HTML        template.HTML // rendered body for the view template
+	Backlinks   []string      // pages linking here
+	User        *User         // logged-in user, nil for anonymous visitors
+
+	RedirectedFrom string       // the redirect stub the visitor came through
+	Attachments    []Attachment // files attached to the page
+	Static         bool         // rendering for a static export: no forms or links to dynamic pages
+	Categories     []string
+	TOC            []*heading // table of contents, for pages with enough headings
+	Templates      []string   // templates a new page can be started from
+	Template       string     // the template the body was filled in from
+	Summary        string     // edit summary and author name kept across a preview
+	Author         string
+}
+
+func (wk *Wiki) renderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, data any) {
+	wk.renderTemplateStatus(w, r, http.StatusOK, tmpl, data)
+}
+
+// renderTemplateStatus executes a template and adds the CSRF token to every POST form in the output
+func (wk *Wiki) renderTemplateStatus(w http.ResponseWriter, r *http.Request, status int, tmpl string, data any) {
+	var buf bytes.Buffer
+	if err := wk.templates.ExecuteTemplate(&buf, tmpl+".html", data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	out := buf.Bytes()
+	if postForm.Match(out) {
+		field := `$0<input type="hidden" name="` + csrfField + `" value="` + wk.csrfToken(w, r) + `">`
+		out = postForm.ReplaceAll(out, []byte(field))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(out)
 }
 
-func viewHandler(w http.ResponseWriter, r *http.Request, title string) {
-	p, err := loadPage(title)
+// author identifies who made an edit: the logged-in user, else the name given with the edit,
+// else the client address
+func author(r *http.Request) string {
+	if u := currentUser(r); u != nil {
+		return u.Name
+	}
+	if name := strings.TrimSpace(r.FormValue("author")); name != "" {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		http.Redirect(w, r, "/edit/"+title, http.StatusFound)
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (wk *Wiki) viewHandler(w http.ResponseWriter, r *http.Request, title string) {
+	if v := r.URL.Query().Get("rev"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid revision", http.StatusBadRequest)
+			return
+		}
+		rev, err := wk.loadRevision(title, id)
+		if err != nil {
+			revisionError(w, r, err)
+			return
+		}
+		wk.renderView(w, r, &pageView{Page: &Page{Title: title, Body: rev.Body, Revision: rev.ID}, OldRevision: rev})
 		return
 	}
-	renderTemplate(w, "view", p)
+	p, err := wk.loadPage(title)
+	if err != nil {
+		http.Redirect(w, r, "/edit/"+slug(title), http.StatusFound)
+		return
+	}
+	if followRedirect(w, r, p) {
+		return
+	}
+	v := &pageView{Page: p}
+	if from, ok := normalizeTitle(r.URL.Query().Get("from")); ok {
+		v.RedirectedFrom = from
+	}
+	wk.renderView(w, r, v)
 }
 
-func editHandler(w http.ResponseWriter, r *http.Request, title string) {
-	p, err := loadPage(title)
+// renderView renders the page body to HTML and executes the view template
+func (wk *Wiki) renderView(w http.ResponseWriter, r *http.Request, v *pageView) {
+	html, headings, err := wk.renderPage(r, v.Title, v.Body)
 	if err != nil {
-		p = &Page{Title: title}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	v.HTML, v.TOC = html, wk.tableOfContents(headings)
+	if v.OldRevision == nil {
+		if v.Attachments, err = wk.store.Attachments(v.Title); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	}
-	renderTemplate(w, "edit", p)
+	v.Backlinks = wk.readable(r, wk.linkIndex().backlinks(v.Title))
+	v.Categories = pageCategories(v.Body)
+	v.User = currentUser(r)
+	wk.renderTemplate(w, r, "view", v)
 }
 
-func saveHandler(w http.ResponseWriter, r *http.Request, title string) {
+// editHandler offers new pages a choice of templates to start from; ?template=Name fills in its text
+func (wk *Wiki) editHandler(w http.ResponseWriter, r *http.Request, title string) {
+	p, err := wk.loadPage(title)
+	if err == nil {
+		wk.renderTemplate(w, r, "edit", &pageView{Page: p, User: currentUser(r)})
+		return
+	}
+	v := &pageView{Page: &Page{Title: title}, User: currentUser(r)}
+	if v.Templates, err = wk.templateNames(r); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if name := r.URL.Query().Get("template"); name != "" {
+		t, ok := normalizeTitle(templatePrefix + name)
+		if !ok || !wk.allowed(r, t, readAccess) {
+			http.NotFound(w, r)
+			return
+		}
+		tp, err := wk.loadPage(t)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		v.Body = tp.Body
+		v.Template = strings.TrimPrefix(t, templatePrefix)
+	}
+	wk.renderTemplate(w, r, "edit", v)
+}
+
+func (wk *Wiki) saveHandler(w http.ResponseWriter, r *http.Request, title string) {
 	body := r.FormValue("body")
 	p := &Page{Title: title, Body: []byte(body)}
-	err := p.save()
+	err := wk.save(p, formBase(r), author(r), r.FormValue("summary"))
+	if errors.Is(err, errEditConflict) {
+		current, err := wk.loadPage(title)
+		if err != nil {
+			// The page was deleted while it was being edited
+			current = &Page{Title: title}
+		}
+		wk.renderConflict(w, r, current, p.Body)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/view/"+slug(title), http.StatusFound)
+}
+
+// previewHandler renders the posted body the way viewHandler would, without saving it, above the
+// edit form filled in as it was posted. Scripts can post fragment=1 to get just the rendered body.
+func (wk *Wiki) previewHandler(w http.ResponseWriter, r *http.Request, title string) {
+	v := &pageView{
+		Page:    &Page{Title: title, Body: []byte(r.FormValue("body")), Revision: formBase(r)},
+		User:    currentUser(r),
+		Summary: r.FormValue("summary"),
+		Author:  r.FormValue("author"),
+	}
+	html, headings, err := wk.renderPage(r, title, v.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.FormValue("fragment") != "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(html))
+		return
+	}
+	v.HTML, v.TOC = html, wk.tableOfContents(headings)
+	v.Categories = pageCategories(v.Body)
+	wk.renderTemplate(w, r, "edit", v)
+}
+
+func (wk *Wiki) deleteHandler(w http.ResponseWriter, r *http.Request, title string) {
+	err := wk.delete(title, formBase(r))
+	if errors.Is(err, errEditConflict) {
+		http.Error(w, "the page was changed since you loaded it, reload it and try again", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/view/"+title, http.StatusFound)
+	http.Redirect(w, r, "/", http.StatusFound)
 }
 
-var templates = template.Must(template.ParseFiles("edit.html", "view.html"))
-var validPath = regexp.MustCompile("^/(edit|save|view)/([a-zA-Z0-9]+)$")
+// frontPage is where "/" leads, and so where logging in, logging out and deleting a page end up
+const frontPage = "Home"
 
-func makeHandler(fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+func frontPageHandler(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/view/"+slug(frontPage), http.StatusFound)
+}
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+// templateFuncs are available to every template, including overrides
+var templateFuncs = template.FuncMap{"slug": slug, "fileURL": fileURL}
+
+var templates = template.Must(template.New("").Funcs(templateFuncs).ParseFS(templateFS, "templates/*.html"))
+
+// parseTemplates returns the built-in templates overridden by any *.html files in dir
+func parseTemplates(dir string) (*template.Template, error) {
+	// Parsed afresh because html/template cannot Clone a set that has already executed
+	t, err := template.New("").Funcs(templateFuncs).ParseFS(templateFS, "templates/*.html")
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil || len(files) == 0 {
+		return t, err
+	}
+	return t.ParseFiles(files...)
+}
+
+var validPath = regexp.MustCompile("^/(edit|save|preview|delete|move|upload|view|history|diff|backlinks|events)/(.+)$")
+
+// makeHandler validates the title in the path and checks the requester has the access fn needs.
+// GET requests for a title spelled differently from its canonical slug are redirected to it.
+func (wk *Wiki) makeHandler(need access, fn func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		m := validPath.FindStringSubmatch(r.URL.Path)
 		if m == nil {
 			http.NotFound(w, r)
 			return
 		}
-		fn(w, r, m[2])
+		title, ok := normalizeTitle(m[2])
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method == http.MethodGet && m[2] != strings.ReplaceAll(title, " ", "_") {
+			target := "/" + m[1] + "/" + slug(title)
+			if r.URL.RawQuery != "" {
+				target += "?" + r.URL.RawQuery
+			}
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+			return
+		}
+		if !wk.allowed(r, title, need) {
+			wk.deny(w, r)
+			return
+		}
+		fn(w, r, title)
 	}
 }
 
-// Serve starts the Go http server
-func Serve() {
-	http.HandleFunc("/view/", makeHandler(viewHandler))
-	http.HandleFunc("/edit/", makeHandler(editHandler))
-	http.HandleFunc("/save/", makeHandler(saveHandler))
+// routes registers the wiki handlers on a new ServeMux
+func (wk *Wiki) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", frontPageHandler)
+	mux.HandleFunc("/view/", wk.makeHandler(readAccess, wk.viewHandler))
+	mux.HandleFunc("/edit/", wk.makeHandler(editAccess, wk.editHandler))
+	mux.HandleFunc("/save/", wk.protect(wk.makeHandler(editAccess, wk.saveHandler)))
+	mux.HandleFunc("/preview/", wk.protect(wk.makeHandler(editAccess, wk.previewHandler)))
+	mux.HandleFunc("/delete/", wk.protect(wk.makeHandler(editAccess, wk.deleteHandler)))
+	mux.HandleFunc("GET /move/", wk.makeHandler(editAccess, wk.moveFormHandler))
+	mux.HandleFunc("/upload/", wk.limitUpload(wk.protect(wk.makeHandler(editAccess, wk.uploadHandler))))
+	mux.HandleFunc("GET /files/", wk.fileHandler)
+	mux.HandleFunc("/delete-file/", wk.protect(wk.deleteFileHandler))
+	mux.HandleFunc("/move/", wk.protect(wk.makeHandler(editAccess, wk.moveHandler)))
+	mux.HandleFunc("/history/", wk.makeHandler(readAccess, wk.historyHandler))
+	mux.HandleFunc("/diff/", wk.makeHandler(readAccess, wk.diffHandler))
+	mux.HandleFunc("/revert/", wk.protect(wk.revertHandler))
+	mux.HandleFunc("/backlinks/", wk.makeHandler(readAccess, wk.backlinksHandler))
+	mux.HandleFunc("/search", wk.searchHandler)
+	mux.HandleFunc("/recent", wk.recentHandler)
+	mux.HandleFunc("/special/", wk.specialHandler)
+	mux.HandleFunc("/category/", wk.categoryHandler)
+	mux.HandleFunc("/recent.atom", wk.atomHandler)
+	mux.HandleFunc("/recent.rss", wk.rssHandler)
+	mux.HandleFunc("/login", wk.loginHandler)
+	mux.HandleFunc("/logout", wk.protect(wk.logoutHandler))
+	mux.HandleFunc("/admin", wk.adminHandler)
+	mux.HandleFunc("GET /events", wk.eventsHandler)
+	mux.HandleFunc("GET /events.js", eventsWorkerHandler)
+	mux.HandleFunc("GET /events/", wk.makeHandler(readAccess, wk.pageEventsHandler))
 
-	log.Fatal(http.ListenAndServe(":8080", nil))
+	mux.HandleFunc("GET /api/v1/pages", wk.apiListPages)
+	mux.HandleFunc("POST /api/v1/pages", wk.apiCreatePage)
+	mux.HandleFunc("GET /api/v1/pages/{title...}", wk.apiPage(wk.apiGetPage))
+	mux.HandleFunc("PUT /api/v1/pages/{title...}", wk.apiPage(wk.apiPutPage))
+	mux.HandleFunc("DELETE /api/v1/pages/{title...}", wk.apiPage(wk.apiDeletePage))
+	return mux
 }
-
-// go build wiki.go
-// ./wiki
-// http://localhost:8080/edit/NewPage
@@ -0,0 +1,141 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"go-wiki/storage"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestWiki returns a wiki backed by an empty in-memory store
+func newTestWiki(t *testing.T) *Wiki {
+	t.Helper()
+	return New(NewStorageStore(storage.NewMemory[[]Revision]()))
+}
+
+// testVisitor is the anonymous CSRF cookie the form helpers present
+var testVisitor = &http.Cookie{Name: csrfCookie, Value: "test"}
+
+// post submits a form the way a browser would after loading it, with a valid CSRF token
+func post(t *testing.T, wk *Wiki, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	return as(t, wk, nil, http.MethodPost, path, form)
+}
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestSaveRecordsRevisions(t *testing.T) {
+	h := newTestWiki(t)
+
+	rec := post(t, h, "/save/Home", url.Values{"body": {"first"}, "author": {"alice"}, "summary": {"create"}})
+	assert.Equal(t, http.StatusFound, rec.Code)
+	post(t, h, "/save/Home", url.Values{"body": {"second"}, "author": {"bob"}})
+
+	revs, err := h.store.History("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(revs))
+	assert.Equal(t, 1, revs[0].ID)
+	assert.Equal(t, "alice", revs[0].Author)
+	assert.Equal(t, "create", revs[0].Summary)
+	assert.Equal(t, "first", string(revs[0].Body))
+	assert.Equal(t, "bob", revs[1].Author)
+
+	p, err := h.loadPage("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(p.Body))
+}
+
+func TestViewRevision(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"first"}})
+	post(t, h, "/save/Home", url.Values{"body": {"second"}})
+
+	rec := get(t, h, "/view/Home?rev=1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "first")
+	assert.NotContains(t, rec.Body.String(), "second")
+
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/view/Home?rev=3").Code)
+	assert.Equal(t, http.StatusBadRequest, get(t, h, "/view/Home?rev=x").Code)
+}
+
+func TestHistory(t *testing.T) {
+	h := newTestWiki(t)
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/history/Home").Code)
+
+	post(t, h, "/save/Home", url.Values{"body": {"first"}, "summary": {"typo fix"}})
+	rec := get(t, h, "/history/Home")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "/view/Home?rev=1")
+	assert.Contains(t, rec.Body.String(), "typo fix")
+}
+
+func TestRevert(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Home", url.Values{"body": {"good"}})
+	post(t, h, "/save/Home", url.Values{"body": {"vandalized"}})
+
+	assert.Equal(t, http.StatusMethodNotAllowed, get(t, h, "/revert/Home/1").Code)
+	assert.Equal(t, http.StatusNotFound, post(t, h, "/revert/Home/9", nil).Code)
+
+	rec := post(t, h, "/revert/Home/1", nil)
+	assert.Equal(t, http.StatusFound, rec.Code)
+
+	p, err := h.loadPage("Home")
+	assert.NoError(t, err)
+	assert.Equal(t, "good", string(p.Body))
+
+	revs, _ := h.store.History("Home")
+	assert.Equal(t, 3, len(revs))
+	assert.Equal(t, "Reverted to revision 1", revs[2].Summary)
+}
+
+func TestFrontPage(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Old", url.Values{"body": {"x"}})
+	rec := post(t, h, "/delete/Old", url.Values{"base": {"1"}})
+	assert.Equal(t, "/", rec.Header().Get("Location"))
+
+	rec = get(t, h, "/")
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "/view/Home", rec.Header().Get("Location"))
+	assert.Equal(t, http.StatusNotFound, get(t, h, "/nope").Code)
+}
+
+func TestPreview(t *testing.T) {
+	h := newTestWiki(t)
+	post(t, h, "/save/Template:Note", url.Values{"body": {"*Note:* {{{1}}}"}})
+	post(t, h, "/save/Home", url.Values{"body": {"old"}})
+
+	assert.Contains(t, get(t, h, "/edit/Home").Body.String(), `formaction="/preview/Home"`)
+
+	form := url.Values{"body": {"## Intro\n\n{{Template:Note|read [[Home]]}} [[Category:Docs]]"}, "base": {"1"}, "summary": {"draft <b>"}, "author": {"ann"}}
+	rec := post(t, h, "/preview/Home", form)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `<h2 id="intro">Intro</h2>`)
+	assert.Contains(t, body, `<em>Note:</em> read <a class="wikilink" href="/view/Home">Home</a>`)
+	assert.Contains(t, body, `<a href="/category/Docs">Docs</a>`)
+	assert.Contains(t, body, `<input type="hidden" name="base" value="1">`)
+	assert.Contains(t, body, `value="draft &lt;b&gt;"`)
+	assert.Contains(t, body, `value="ann"`)
+	assert.Contains(t, body, "{{Template:Note|read [[Home]]}} [[Category:Docs]]</textarea>")
+
+	form.Set("fragment", "1")
+	rec = post(t, h, "/preview/Home", form)
+	assert.Equal(t, `<h2 id="intro">Intro</h2>`+"\n"+`<p><em>Note:</em> read <a class="wikilink" href="/view/Home">Home</a> </p>`+"\n", rec.Body.String())
+
+	// Nothing was saved
+	revs, _ := h.store.History("Home")
+	assert.Equal(t, 1, len(revs))
+	assert.Equal(t, http.StatusMethodNotAllowed, get(t, h, "/preview/Home").Code)
+}
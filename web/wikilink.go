@@ -0,0 +1,186 @@
+package web
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// wikiLink is an inline [[Target]] or [[Target|label]] reference to another page
+type wikiLink struct {
+	ast.BaseInline
+	Target  string
+	Label   string
+	Missing bool         // set before rendering when the target page does not exist
+	Source  text.Segment // the whole [[...]] in the page source, for rewriting links
+	Labeled bool         // whether the source gave a label
+}
+
+var kindWikiLink = ast.NewNodeKind("WikiLink")
+
+func (n *wikiLink) Kind() ast.NodeKind {
+	return kindWikiLink
+}
+
+func (n *wikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target, "Label": n.Label}, nil)
+}
+
+// wikiFile is an inline [[File:name]] or [[File:Page/name|text]] reference to an attachment,
+// shown as an image for image files and as a download link otherwise
+type wikiFile struct {
+	ast.BaseInline
+	Page  string // page the file is attached to; empty means the page being rendered
+	Name  string
+	Label string
+}
+
+var kindWikiFile = ast.NewNodeKind("WikiFile")
+
+func (n *wikiFile) Kind() ast.NodeKind {
+	return kindWikiFile
+}
+
+func (n *wikiFile) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Page": n.Page, "Name": n.Name, "Label": n.Label}, nil)
+}
+
+// parseFileLink parses the target of a [[File:...]] link
+func parseFileLink(target, label string) ast.Node {
+	ref := strings.TrimSpace(target[len("File:"):])
+	page := ""
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		var ok bool
+		if page, ok = normalizeTitle(ref[:i]); !ok {
+			return nil
+		}
+		ref = ref[i+1:]
+	}
+	name, ok := normalizeAttachmentName(ref)
+	if !ok || name != strings.TrimSpace(ref) {
+		return nil
+	}
+	if label == "" {
+		label = name
+	}
+	return &wikiFile{Page: page, Name: name, Label: label}
+}
+
+// wikiCategory is an inline [[Category:Name]] putting the page in a category. It renders as
+// nothing; the view template lists the categories at the end of the page.
+type wikiCategory struct {
+	ast.BaseInline
+	Name string
+}
+
+var kindWikiCategory = ast.NewNodeKind("WikiCategory")
+
+func (n *wikiCategory) Kind() ast.NodeKind {
+	return kindWikiCategory
+}
+
+func (n *wikiCategory) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Name": n.Name}, nil)
+}
+
+var wikiLinkPattern = regexp.MustCompile(`^\[\[([^\[\]|]+)(?:\|([^\[\]]*))?\]\]`)
+
+type wikiLinkParser struct{}
+
+func (wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, seg := block.PeekLine()
+	m := wikiLinkPattern.FindSubmatch(line)
+	if m == nil {
+		return nil
+	}
+	if bytes.HasPrefix(m[1], []byte("File:")) {
+		n := parseFileLink(string(m[1]), string(m[2]))
+		if n != nil {
+			block.Advance(len(m[0]))
+		}
+		return n
+	}
+	if name, found := bytes.CutPrefix(m[1], []byte("Category:")); found {
+		category, ok := normalizeTitle(string(name))
+		if !ok {
+			return nil
+		}
+		block.Advance(len(m[0]))
+		return &wikiCategory{Name: category}
+	}
+	target, ok := normalizeTitle(string(m[1]))
+	if !ok {
+		return nil
+	}
+	block.Advance(len(m[0]))
+	link := &wikiLink{Target: target, Label: string(m[2]), Labeled: m[2] != nil}
+	link.Source = text.NewSegment(seg.Start, seg.Start+len(m[0]))
+	if link.Label == "" {
+		link.Label = link.Target
+	}
+	return link
+}
+
+type wikiLinkRenderer struct{}
+
+func (wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindWikiLink, renderWikiLink)
+	reg.Register(kindWikiFile, renderWikiFile)
+	reg.Register(kindWikiCategory, func(util.BufWriter, []byte, ast.Node, bool) (ast.WalkStatus, error) {
+		return ast.WalkSkipChildren, nil
+	})
+}
+
+// renderWikiLink points existing pages at /view and missing ones at /edit so they can be written
+func renderWikiLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*wikiLink)
+	href := util.EscapeHTML([]byte(slug(n.Target)))
+	if n.Missing {
+		w.WriteString(`<a class="wikilink missing" href="/edit/` + string(href) + `" title="`)
+		w.Write(util.EscapeHTML([]byte(n.Target)))
+		w.WriteString(` (page does not exist)">`)
+	} else {
+		w.WriteString(`<a class="wikilink" href="/view/` + string(href) + `">`)
+	}
+	w.Write(util.EscapeHTML([]byte(n.Label)))
+	w.WriteString("</a>")
+	return ast.WalkSkipChildren, nil
+}
+
+func renderWikiFile(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*wikiFile)
+	href := util.EscapeHTML([]byte(fileURL(n.Page, n.Name)))
+	label := util.EscapeHTML([]byte(n.Label))
+	if isImageName(n.Name) {
+		w.WriteString(`<img class="attachment" src="` + string(href) + `" alt="` + string(label) + `">`)
+	} else {
+		w.WriteString(`<a class="attachment" href="` + string(href) + `">` + string(label) + `</a>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// wikiLinks is a goldmark extension adding the [[WikiLink]] syntax
+type wikiLinks struct{}
+
+func (wikiLinks) Extend(m goldmark.Markdown) {
+	// Runs just ahead of the standard link parser, which also triggers on '['
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(wikiLinkParser{}, 199)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(wikiLinkRenderer{}, 199)))
+}